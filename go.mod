@@ -1 +1,8 @@
 module github.com/xzor-dev/xzor
+
+require (
+	github.com/fxamacker/cbor/v2 v2.4.0
+	google.golang.org/protobuf v1.28.1
+)
+
+require github.com/x448/float16 v0.8.4 // indirect
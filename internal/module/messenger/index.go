@@ -0,0 +1,27 @@
+package messenger
+
+import "github.com/xzor-dev/xzor/internal/xzor/storage"
+
+// ThreadTitleIndexName is the name of the index of threads by title.
+const ThreadTitleIndexName = "messenger-thread-title"
+
+// Indexes returns the storage indexes used by the messenger, to be included in the
+// Indexes of its storage service.
+func Indexes() []*storage.Index {
+	return []*storage.Index{
+		{
+			Keys: func(record interface{}) []string {
+				t, ok := record.(*Thread)
+				if !ok {
+					return nil
+				}
+				return []string{t.Title}
+			},
+			Name: ThreadTitleIndexName,
+			NewRecord: func() interface{} {
+				return &Thread{}
+			},
+			Prefix: threadPrefix,
+		},
+	}
+}
@@ -9,10 +9,13 @@ import (
 	"github.com/xzor-dev/xzor/internal/module/messenger"
 	"github.com/xzor-dev/xzor/internal/module/messenger/command"
 	"github.com/xzor-dev/xzor/internal/xzor/action"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
 	"github.com/xzor-dev/xzor/internal/xzor/module"
 	"github.com/xzor-dev/xzor/internal/xzor/storage"
 	"github.com/xzor-dev/xzor/internal/xzor/storage/file"
 	"github.com/xzor-dev/xzor/internal/xzor/storage/json"
+	"github.com/xzor-dev/xzor/internal/xzor/storage/memory"
+	"github.com/xzor-dev/xzor/internal/xzor/storage/protobuf"
 )
 
 func TestModule(t *testing.T) {
@@ -75,6 +78,17 @@ func TestModule(t *testing.T) {
 				if err != nil {
 					return err
 				}
+				boards, err := srv.Boards()
+				if err != nil {
+					return err
+				}
+				found := false
+				for _, b := range boards {
+					found = found || b.Hash == board.Hash
+				}
+				if !found {
+					return errors.New("expected board to be listed")
+				}
 				boardHash = board.Hash
 				return nil
 			},
@@ -192,3 +206,60 @@ func TestModule(t *testing.T) {
 		}
 	})
 }
+
+func TestConcurrentThreads(t *testing.T) {
+	srv := &messenger.Service{
+		Storage: &storage.Service{
+			Cache:         &common.LRU{MaxEntries: 4},
+			EncodeDecoder: &protobuf.EncodeDecoder{},
+			Indexes:       messenger.Indexes(),
+			MaxRetries:    100,
+			Store:         &memory.RecordStore{},
+		},
+	}
+	board, err := srv.NewBoard("foo")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	writers := 10
+	errs := make(chan error)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			_, err := srv.NewThread(board.Hash, fmt.Sprintf("thread %d", i))
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < writers; i++ {
+		err := <-errs
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	board, err = srv.Board(board.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(board.Threads) != writers {
+		t.Fatalf("expected no lost thread updates: wanted %d threads, got %d", writers, len(board.Threads))
+	}
+
+	threads, err := srv.ThreadsByTitle("thread 3")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(threads) != 1 || threads[0].Title != "thread 3" {
+		t.Fatal("expected to find the thread by its title")
+	}
+	err = srv.DeleteThread(threads[0].Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	threads, err = srv.ThreadsByTitle("thread 3")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(threads) != 0 {
+		t.Fatal("expected a deleted thread to be removed from the title index")
+	}
+}
@@ -0,0 +1,4 @@
+// Package pb holds the protobuf schemas of messenger records.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative messenger.proto
@@ -0,0 +1,105 @@
+package messenger
+
+import (
+	"errors"
+
+	"github.com/xzor-dev/xzor/internal/module/messenger/pb"
+	"github.com/xzor-dev/xzor/internal/xzor/storage/protobuf"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ protobuf.Record = &Board{}
+var _ protobuf.Record = &Message{}
+var _ protobuf.Record = &Thread{}
+
+var errInvalidProto = errors.New("unexpected protobuf message type")
+
+// FromProto sets the board's fields from its protobuf message.
+func (b *Board) FromProto(m proto.Message) error {
+	p, ok := m.(*pb.Board)
+	if !ok {
+		return errInvalidProto
+	}
+	b.Hash = BoardHash(p.Hash)
+	b.Threads = make([]ThreadHash, len(p.Threads))
+	for i, h := range p.Threads {
+		b.Threads[i] = ThreadHash(h)
+	}
+	b.Title = p.Title
+	return nil
+}
+
+// NewProto returns an empty protobuf message for decoding a board.
+func (b *Board) NewProto() proto.Message {
+	return &pb.Board{}
+}
+
+// ToProto converts the board into its protobuf message.
+func (b *Board) ToProto() proto.Message {
+	threads := make([]string, len(b.Threads))
+	for i, h := range b.Threads {
+		threads[i] = string(h)
+	}
+	return &pb.Board{
+		Hash:    string(b.Hash),
+		Threads: threads,
+		Title:   b.Title,
+	}
+}
+
+// FromProto sets the message's fields from its protobuf message.
+func (msg *Message) FromProto(m proto.Message) error {
+	p, ok := m.(*pb.Message)
+	if !ok {
+		return errInvalidProto
+	}
+	msg.Body = p.Body
+	msg.Hash = MessageHash(p.Hash)
+	return nil
+}
+
+// NewProto returns an empty protobuf message for decoding a message.
+func (msg *Message) NewProto() proto.Message {
+	return &pb.Message{}
+}
+
+// ToProto converts the message into its protobuf message.
+func (msg *Message) ToProto() proto.Message {
+	return &pb.Message{
+		Body: msg.Body,
+		Hash: string(msg.Hash),
+	}
+}
+
+// FromProto sets the thread's fields from its protobuf message.
+func (t *Thread) FromProto(m proto.Message) error {
+	p, ok := m.(*pb.Thread)
+	if !ok {
+		return errInvalidProto
+	}
+	t.Hash = ThreadHash(p.Hash)
+	t.Messages = make([]MessageHash, len(p.Messages))
+	for i, h := range p.Messages {
+		t.Messages[i] = MessageHash(h)
+	}
+	t.Title = p.Title
+	return nil
+}
+
+// NewProto returns an empty protobuf message for decoding a thread.
+func (t *Thread) NewProto() proto.Message {
+	return &pb.Thread{}
+}
+
+// ToProto converts the thread into its protobuf message.
+func (t *Thread) ToProto() proto.Message {
+	messages := make([]string, len(t.Messages))
+	for i, h := range t.Messages {
+		messages[i] = string(h)
+	}
+	return &pb.Thread{
+		Hash:     string(t.Hash),
+		Messages: messages,
+		Title:    t.Title,
+	}
+}
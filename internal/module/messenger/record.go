@@ -0,0 +1,71 @@
+package messenger
+
+import "github.com/xzor-dev/xzor/internal/xzor/storage"
+
+// Record types and schema versions stored in the headers of messenger records.
+const (
+	BoardRecordType   = "messenger.board"
+	MessageRecordType = "messenger.message"
+	ThreadRecordType  = "messenger.thread"
+
+	BoardSchemaVersion   = 1
+	MessageSchemaVersion = 1
+	ThreadSchemaVersion  = 1
+)
+
+var _ storage.VersionedRecord = &Board{}
+var _ storage.VersionedRecord = &Message{}
+var _ storage.VersionedRecord = &Thread{}
+var _ storage.RecordCopier = &Board{}
+var _ storage.RecordCopier = &Message{}
+var _ storage.RecordCopier = &Thread{}
+
+// RecordType returns the type stored in the board's record header.
+func (b *Board) RecordType() string {
+	return BoardRecordType
+}
+
+// SchemaVersion returns the current schema version of boards.
+func (b *Board) SchemaVersion() uint64 {
+	return BoardSchemaVersion
+}
+
+// RecordType returns the type stored in the message's record header.
+func (msg *Message) RecordType() string {
+	return MessageRecordType
+}
+
+// SchemaVersion returns the current schema version of messages.
+func (msg *Message) SchemaVersion() uint64 {
+	return MessageSchemaVersion
+}
+
+// RecordType returns the type stored in the thread's record header.
+func (t *Thread) RecordType() string {
+	return ThreadRecordType
+}
+
+// SchemaVersion returns the current schema version of threads.
+func (t *Thread) SchemaVersion() uint64 {
+	return ThreadSchemaVersion
+}
+
+// CopyRecord returns a copy of the board that shares none of its threads.
+func (b *Board) CopyRecord() interface{} {
+	c := *b
+	c.Threads = append([]ThreadHash(nil), b.Threads...)
+	return &c
+}
+
+// CopyRecord returns a copy of the message.
+func (msg *Message) CopyRecord() interface{} {
+	c := *msg
+	return &c
+}
+
+// CopyRecord returns a copy of the thread that shares none of its messages.
+func (t *Thread) CopyRecord() interface{} {
+	c := *t
+	c.Messages = append([]MessageHash(nil), t.Messages...)
+	return &c
+}
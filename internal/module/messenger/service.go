@@ -2,23 +2,30 @@ package messenger
 
 import "github.com/xzor-dev/xzor/internal/xzor/storage"
 
+// Prefixes of the record IDs used to store each type of messenger record.
+const (
+	boardPrefix   = "board-"
+	messagePrefix = "message-"
+	threadPrefix  = "thread-"
+)
+
 // Service handles messaging.
 type Service struct {
 	Storage *storage.Service
 }
 
 func (s *Service) boardID(hash BoardHash) storage.RecordID {
-	id := "board-" + string(hash)
+	id := boardPrefix + string(hash)
 	return storage.RecordID(id)
 }
 
 func (s *Service) messageID(hash MessageHash) storage.RecordID {
-	id := "message-" + string(hash)
+	id := messagePrefix + string(hash)
 	return storage.RecordID(id)
 }
 
 func (s *Service) threadID(hash ThreadHash) storage.RecordID {
-	id := "thread-" + string(hash)
+	id := threadPrefix + string(hash)
 	return storage.RecordID(id)
 }
 
@@ -33,22 +40,40 @@ func (s *Service) Board(hash BoardHash) (*Board, error) {
 	return board, nil
 }
 
-// DeleteBoard removes a board and all its threads from the storage.
-func (s *Service) DeleteBoard(hash BoardHash) error {
-	board, err := s.Board(hash)
+// Boards returns every stored board ordered by hash.
+func (s *Service) Boards() ([]*Board, error) {
+	records, err := s.Storage.ListRecords(&storage.ListOptions{
+		Prefix: boardPrefix,
+	}, func() interface{} {
+		return &Board{}
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if board.Threads != nil {
+	boards := make([]*Board, len(records))
+	for i, r := range records {
+		boards[i] = r.Value.(*Board)
+	}
+	return boards, nil
+}
+
+// DeleteBoard removes a board and all its threads from the storage in a single transaction.
+func (s *Service) DeleteBoard(hash BoardHash) error {
+	return s.Storage.Update(func(tx *storage.Tx) error {
+		board := &Board{}
+		err := tx.Read(s.boardID(hash), board)
+		if err != nil {
+			return err
+		}
 		for _, threadHash := range board.Threads {
-			err := s.DeleteThread(threadHash)
+			err := s.deleteThread(tx, threadHash)
 			if err != nil {
 				return err
 			}
 		}
-	}
-	id := s.boardID(hash)
-	return s.Storage.Delete(id)
+		tx.Delete(s.boardID(hash))
+		return nil
+	})
 }
 
 // DeleteMessage removes a message from the storage.
@@ -57,22 +82,24 @@ func (s *Service) DeleteMessage(hash MessageHash) error {
 	return s.Storage.Delete(id)
 }
 
-// DeleteThread removes a thread and all its messages from the storage.
+// DeleteThread removes a thread and all its messages from the storage in a single transaction.
 func (s *Service) DeleteThread(hash ThreadHash) error {
-	thread, err := s.Thread(hash)
+	return s.Storage.Update(func(tx *storage.Tx) error {
+		return s.deleteThread(tx, hash)
+	})
+}
+
+func (s *Service) deleteThread(tx *storage.Tx, hash ThreadHash) error {
+	thread := &Thread{}
+	err := tx.Read(s.threadID(hash), thread)
 	if err != nil {
 		return err
 	}
-	if thread.Messages != nil {
-		for _, messageHash := range thread.Messages {
-			err := s.DeleteMessage(messageHash)
-			if err != nil {
-				return err
-			}
-		}
+	for _, messageHash := range thread.Messages {
+		tx.Delete(s.messageID(messageHash))
 	}
-	id := s.threadID(hash)
-	return s.Storage.Delete(id)
+	tx.Delete(s.threadID(hash))
+	return nil
 }
 
 // Message returns a message by its hash.
@@ -104,20 +131,25 @@ func (s *Service) NewBoard(title string) (*Board, error) {
 }
 
 // NewMessage creates a new message in a thread.
+// The thread is updated in a transaction that is retried if another writer updates it first.
 func (s *Service) NewMessage(threadHash ThreadHash, body string) (*Message, error) {
-	thread, err := s.Thread(threadHash)
-	if err != nil {
-		return nil, err
-	}
-	message, err := thread.NewMessage(body)
-	if err != nil {
-		return nil, err
-	}
-	err = s.SetMessage(message)
-	if err != nil {
-		return nil, err
-	}
-	err = s.SetThread(thread)
+	var message *Message
+	err := s.Storage.Update(func(tx *storage.Tx) error {
+		thread := &Thread{}
+		err := tx.Read(s.threadID(threadHash), thread)
+		if err != nil {
+			return err
+		}
+		message, err = thread.NewMessage(body)
+		if err != nil {
+			return err
+		}
+		err = tx.Write(s.messageID(message.Hash), message)
+		if err != nil {
+			return err
+		}
+		return tx.Write(s.threadID(thread.Hash), thread)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -125,20 +157,25 @@ func (s *Service) NewMessage(threadHash ThreadHash, body string) (*Message, erro
 }
 
 // NewThread creates a new thread within a board.
+// The board is updated in a transaction that is retried if another writer updates it first.
 func (s *Service) NewThread(boardHash BoardHash, title string) (*Thread, error) {
-	board, err := s.Board(boardHash)
-	if err != nil {
-		return nil, err
-	}
-	thread, err := board.NewThread(title)
-	if err != nil {
-		return nil, err
-	}
-	err = s.SetThread(thread)
-	if err != nil {
-		return nil, err
-	}
-	err = s.SetBoard(board)
+	var thread *Thread
+	err := s.Storage.Update(func(tx *storage.Tx) error {
+		board := &Board{}
+		err := tx.Read(s.boardID(boardHash), board)
+		if err != nil {
+			return err
+		}
+		thread, err = board.NewThread(title)
+		if err != nil {
+			return err
+		}
+		err = tx.Write(s.threadID(thread.Hash), thread)
+		if err != nil {
+			return err
+		}
+		return tx.Write(s.boardID(board.Hash), board)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -173,3 +210,22 @@ func (s *Service) Thread(hash ThreadHash) (*Thread, error) {
 	}
 	return thread, nil
 }
+
+// ThreadsByTitle returns the threads with the title, ordered by hash.
+// The storage service must include the messenger's Indexes.
+func (s *Service) ThreadsByTitle(title string) ([]*Thread, error) {
+	ids, err := s.Storage.Lookup(ThreadTitleIndexName, title)
+	if err != nil {
+		return nil, err
+	}
+	threads := make([]*Thread, len(ids))
+	for i, id := range ids {
+		thread := &Thread{}
+		err := s.Storage.Read(id, thread)
+		if err != nil {
+			return nil, err
+		}
+		threads[i] = thread
+	}
+	return threads, nil
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/xzor-dev/xzor/internal/xzor/action"
+	"github.com/xzor-dev/xzor/internal/xzor/block"
 	"github.com/xzor-dev/xzor/internal/xzor/command"
 	"github.com/xzor-dev/xzor/internal/xzor/module"
 )
@@ -41,6 +42,38 @@ func TestIncomingAction(t *testing.T) {
 	}
 }
 
+func TestActionPayload(t *testing.T) {
+	a := &action.Action{
+		Arguments: []interface{}{"foo", "bar"},
+		Command:   command.Name("test-command"),
+		Module:    module.Name("test-module"),
+	}
+	p, err := action.NewPayload(a)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	data, err := block.EncodePayload(p)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	r := &block.PayloadRegistry{}
+	err = action.RegisterPayload(r)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	v, err := r.Decode(data)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	decoded, ok := v.(*action.Action)
+	if !ok {
+		t.Fatalf("expected an action, got %T", v)
+	}
+	if decoded.Command != a.Command || decoded.Module != a.Module || len(decoded.Arguments) != 2 {
+		t.Fatal("expected decoded action to match the original")
+	}
+}
+
 var _ command.Command = &testCommand{}
 
 type testCommand struct {
@@ -0,0 +1,54 @@
+package action
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+)
+
+// PayloadType identifies actions stored in blocks.
+const PayloadType block.PayloadType = "xzor.action"
+
+// PayloadVersion is the current schema version of action payloads.
+const PayloadVersion uint64 = 1
+
+var _ block.PayloadDecoder = &PayloadDecoder{}
+
+// PayloadDecoder decodes actions stored in block payloads.
+type PayloadDecoder struct{}
+
+// DecodePayload converts an action payload back into an action.
+func (d *PayloadDecoder) DecodePayload(p *block.Payload) (interface{}, error) {
+	if p.Type != PayloadType {
+		return nil, block.ErrUnknownPayload
+	}
+	if p.Version != PayloadVersion || p.Encoding != block.EncodingJSON {
+		return nil, errors.New("unsupported action payload")
+	}
+	a := &Action{}
+	err := json.Unmarshal(p.Data, a)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewPayload wraps an action in a block payload.
+func NewPayload(a *Action) (*block.Payload, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return &block.Payload{
+		Data:     data,
+		Encoding: block.EncodingJSON,
+		Type:     PayloadType,
+		Version:  PayloadVersion,
+	}, nil
+}
+
+// RegisterPayload registers the action payload decoder with a payload registry.
+func RegisterPayload(r *block.PayloadRegistry) error {
+	return r.Register(PayloadType, &PayloadDecoder{})
+}
@@ -0,0 +1,366 @@
+package block
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// ArchiveVersion is the version of the archive format written by Export.
+const ArchiveVersion = 1
+
+// maxArchiveRecordSize limits the size of a single archive record, so a corrupt or malicious
+// archive cannot claim a length that exhausts memory.
+const maxArchiveRecordSize = 64 << 20
+
+// archiveMagic identifies chain archives.
+var archiveMagic = []byte("XZORCHAIN")
+
+// Record types within an archive.
+const (
+	archiveHeader byte = iota + 1
+	archiveChain
+	archiveBlock
+	archiveTrailer
+)
+
+// ArchiveHeader describes the contents of an archive.
+type ArchiveHeader struct {
+	Blocks    int
+	Chain     ChainHash
+	Chains    int
+	Timestamp int64
+	Version   int
+}
+
+// archiveTrailerRecord holds the checksum of every record preceding it.
+type archiveTrailerRecord struct {
+	Checksum []byte
+}
+
+// ExportOptions controls what is included in an exported archive.
+type ExportOptions struct {
+	// Branches includes the chains branched from the exported chain, along with their branches.
+	Branches bool
+}
+
+// Export writes a chain and its blocks to a self-describing archive.
+// Every record in the archive carries a CRC-32 checksum and the archive ends
+// with a SHA-256 checksum of its entire contents.
+func (s *Service) Export(w io.Writer, hash ChainHash, opts *ExportOptions) error {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	if s.BlockStore == nil {
+		return errors.New("no BlockStore provided to the storage service")
+	}
+	c, err := s.ReadChain(hash)
+	if err != nil {
+		return err
+	}
+	chains := []*Chain{c}
+	if opts.Branches {
+		branches, err := s.descendants(c, 0)
+		if err != nil {
+			return err
+		}
+		for _, b := range branches {
+			bc, err := s.ReadChain(b.ToChain)
+			if err != nil {
+				return err
+			}
+			chains = append(chains, bc)
+		}
+	}
+
+	header := &ArchiveHeader{
+		Chain:     hash,
+		Chains:    len(chains),
+		Timestamp: Timestamp(s.now()),
+		Version:   ArchiveVersion,
+	}
+	for _, c := range chains {
+		c.mux.Lock()
+		header.Blocks += len(c.Blocks)
+		pruned := c.PrunedIndex > 0
+		c.mux.Unlock()
+		if pruned {
+			return errors.New("cannot export a pruned chain")
+		}
+	}
+
+	sum := sha256.New()
+	aw := &archiveWriter{
+		w: bufio.NewWriter(io.MultiWriter(w, sum)),
+	}
+	aw.w.Write(archiveMagic)
+	aw.write(archiveHeader, header)
+	for _, c := range chains {
+		c.mux.Lock()
+		hashes := c.hashes()
+		aw.write(archiveChain, c)
+		c.mux.Unlock()
+		for _, h := range hashes {
+			b, err := s.BlockStore.Read(h)
+			if err != nil {
+				return err
+			}
+			aw.write(archiveBlock, b)
+		}
+	}
+	if aw.err != nil {
+		return aw.err
+	}
+	err = aw.w.Flush()
+	if err != nil {
+		return err
+	}
+	aw.w = bufio.NewWriter(w)
+	aw.write(archiveTrailer, &archiveTrailerRecord{
+		Checksum: sum.Sum(nil),
+	})
+	if aw.err != nil {
+		return aw.err
+	}
+	return aw.w.Flush()
+}
+
+// Import reads an archive created by Export, verifies its checksums and rebuilds each chain
+// from its blocks with the same validation as Chain.AddBlock, using the service's signature policy
+// and clock rather than the archived chains' settings. Nothing is written to the stores unless
+// the entire archive is valid and none of its chains already exist, in which case ErrChainExists
+// is returned. The archive's primary chain is returned.
+func (s *Service) Import(r io.Reader) (*Chain, error) {
+	sum := sha256.New()
+	ar := &archiveReader{
+		r:   bufio.NewReader(r),
+		sum: sum,
+	}
+	magic := make([]byte, len(archiveMagic))
+	err := ar.readFull(magic)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, archiveMagic) {
+		return nil, ErrInvalidArchive
+	}
+
+	header := &ArchiveHeader{}
+	err = ar.expect(archiveHeader, header)
+	if err != nil {
+		return nil, err
+	}
+	if header.Version != ArchiveVersion {
+		return nil, errors.New("unsupported archive version")
+	}
+
+	chains := make([]*Chain, 0, header.Chains)
+	blocks := make([]*Block, 0, header.Blocks)
+	var current, archived *Chain
+	for {
+		checksum := sum.Sum(nil)
+		typ, data, err := ar.read()
+		if err != nil {
+			return nil, err
+		}
+		if typ == archiveTrailer {
+			trailer := &archiveTrailerRecord{}
+			err = json.Unmarshal(data, trailer)
+			if err != nil {
+				return nil, ErrInvalidArchive
+			}
+			if !bytes.Equal(trailer.Checksum, checksum) {
+				return nil, ErrInvalidArchive
+			}
+			break
+		}
+
+		switch typ {
+		case archiveChain:
+			err = verifyArchivedChain(current, archived)
+			if err != nil {
+				return nil, err
+			}
+			archived = &Chain{}
+			err = json.Unmarshal(data, archived)
+			if err != nil {
+				return nil, ErrInvalidArchive
+			}
+			current = s.newChain(archived.Hash)
+			current.Created = archived.Created
+			current.Description = archived.Description
+			current.Origin = archived.Origin
+			current.Owner = archived.Owner
+			current.TimestampVersion = archived.TimestampVersion
+			if archived.Branches != nil {
+				current.Branches = archived.Branches
+			}
+			chains = append(chains, current)
+		case archiveBlock:
+			if current == nil {
+				return nil, ErrInvalidArchive
+			}
+			b := &Block{}
+			err = json.Unmarshal(data, b)
+			if err != nil {
+				return nil, ErrInvalidArchive
+			}
+			err = current.AddBlock(b)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, b)
+		default:
+			return nil, ErrInvalidArchive
+		}
+	}
+	err = verifyArchivedChain(current, archived)
+	if err != nil {
+		return nil, err
+	}
+	if len(chains) != header.Chains || len(blocks) != header.Blocks || chains[0].Hash != header.Chain {
+		return nil, ErrInvalidArchive
+	}
+
+	if s.BlockStore == nil {
+		return nil, errors.New("no BlockStore provided to the storage service")
+	}
+	for _, c := range chains {
+		_, err := s.ReadChain(c.Hash)
+		if err == nil {
+			return nil, ErrChainExists
+		} else if err != ErrChainNotFound {
+			return nil, err
+		}
+	}
+	// The blocks are protected from garbage collection until their chains are written.
+	for _, b := range blocks {
+		s.commits.begin(b.Hash)
+	}
+	defer func() {
+		for _, b := range blocks {
+			s.commits.end(b.Hash)
+		}
+	}()
+	for _, b := range blocks {
+		err = s.BlockStore.Write(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range chains {
+		err = s.WriteChain(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return chains[0], nil
+}
+
+// verifyArchivedChain checks that a chain rebuilt from an archive's blocks matches the archived chain.
+func verifyArchivedChain(rebuilt *Chain, archived *Chain) error {
+	if rebuilt == nil {
+		return nil
+	}
+	if rebuilt.LastHash != archived.LastHash || len(rebuilt.Blocks) != len(archived.Blocks) {
+		return ErrInvalidArchive
+	}
+	for h, i := range archived.Blocks {
+		if j, ok := rebuilt.Blocks[h]; !ok || i != j {
+			return ErrInvalidArchive
+		}
+	}
+	return nil
+}
+
+// archiveWriter writes archive records, holding on to the first error encountered.
+type archiveWriter struct {
+	err error
+	w   *bufio.Writer
+}
+
+// write appends a record laid out as its type, a 4 byte length, its JSON payload
+// and a CRC-32 of the type and payload.
+func (aw *archiveWriter) write(typ byte, v interface{}) {
+	if aw.err != nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		aw.err = err
+		return
+	}
+	rec := make([]byte, 5, 5+len(data)+4)
+	rec[0] = typ
+	binary.BigEndian.PutUint32(rec[1:5], uint32(len(data)))
+	rec = append(rec, data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(append([]byte{typ}, data...)))
+	rec = append(rec, crc...)
+	_, aw.err = aw.w.Write(rec)
+}
+
+// archiveReader reads archive records while hashing everything it reads.
+type archiveReader struct {
+	r   *bufio.Reader
+	sum io.Writer
+}
+
+// expect reads the next record and decodes it, failing if it is not of the expected type.
+func (ar *archiveReader) expect(typ byte, v interface{}) error {
+	t, data, err := ar.read()
+	if err != nil {
+		return err
+	}
+	if t != typ {
+		return ErrInvalidArchive
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return ErrInvalidArchive
+	}
+	return nil
+}
+
+// read reads the next record and verifies its checksum.
+func (ar *archiveReader) read() (byte, []byte, error) {
+	head := make([]byte, 5)
+	err := ar.readFull(head)
+	if err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(head[1:5])
+	if size > maxArchiveRecordSize {
+		return 0, nil, ErrInvalidArchive
+	}
+	data := make([]byte, size)
+	err = ar.readFull(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	crc := make([]byte, 4)
+	err = ar.readFull(crc)
+	if err != nil {
+		return 0, nil, err
+	}
+	if crc32.ChecksumIEEE(append([]byte{head[0]}, data...)) != binary.BigEndian.Uint32(crc) {
+		return 0, nil, ErrInvalidArchive
+	}
+	return head[0], data, nil
+}
+
+func (ar *archiveReader) readFull(p []byte) error {
+	_, err := io.ReadFull(ar.r, p)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrInvalidArchive
+	} else if err != nil {
+		return err
+	}
+	ar.sum.Write(p)
+	return nil
+}
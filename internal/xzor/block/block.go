@@ -6,13 +6,54 @@ import (
 
 // Block holds sequential data.
 type Block struct {
+	Author       []byte
 	Data         []byte
 	Hash         Hash
 	Index        Index
+	MergeHash    Hash
+	MerkleRoot   Hash
 	PreviousHash Hash
+	Signature    []byte
 	Timestamp    int64
 }
 
+// Copy returns a deep copy of the block.
+func (b *Block) Copy() *Block {
+	cp := *b
+	cp.Author = copyBytes(b.Author)
+	cp.Data = copyBytes(b.Data)
+	cp.Signature = copyBytes(b.Signature)
+	return &cp
+}
+
+// Header returns the block's header, which holds a digest of the block's data in place of the data itself.
+func (b *Block) Header() (*Header, error) {
+	dataHash, err := common.NewHash(b.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &Header{
+		Author:       b.Author,
+		DataHash:     Hash(dataHash),
+		Hash:         b.Hash,
+		Index:        b.Index,
+		MergeHash:    b.MergeHash,
+		MerkleRoot:   b.MerkleRoot,
+		PreviousHash: b.PreviousHash,
+		Signature:    b.Signature,
+		Timestamp:    b.Timestamp,
+	}, nil
+}
+
+// header returns the canonical encoding of the block's header.
+func (b *Block) header() ([]byte, error) {
+	h, err := b.Header()
+	if err != nil {
+		return nil, err
+	}
+	return h.encode(), nil
+}
+
 // Hash is a unique string generated from a block.
 type Hash string
 
@@ -20,8 +61,11 @@ type Hash string
 func NewHash(b *Block) (Hash, error) {
 	var bh Hash
 
-	record := string(b.Index) + string(b.Timestamp) + string(b.Data) + string(b.PreviousHash)
-	hash, err := common.NewHash([]byte(record))
+	header, err := b.header()
+	if err != nil {
+		return bh, err
+	}
+	hash, err := common.NewHash(header)
 	if err != nil {
 		return bh, err
 	}
@@ -39,3 +83,17 @@ type Store interface {
 	Read(Hash) (*Block, error)
 	Write(*Block) error
 }
+
+// Committer writes a block along with the chain it was appended to as a single atomic operation.
+type Committer interface {
+	Commit(*Block, *Chain) error
+}
+
+func copyBytes(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	cp := make([]byte, len(data))
+	copy(cp, data)
+	return cp
+}
@@ -1,13 +1,24 @@
 package block_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/block/cache"
+	"github.com/xzor-dev/xzor/internal/xzor/block/encrypted"
 	"github.com/xzor-dev/xzor/internal/xzor/block/file"
 	"github.com/xzor-dev/xzor/internal/xzor/block/memory"
+	"github.com/xzor-dev/xzor/internal/xzor/block/segment"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+	"github.com/xzor-dev/xzor/internal/xzor/encryption"
 )
 
 func TestChain(t *testing.T) {
@@ -43,9 +54,19 @@ func TestService(t *testing.T) {
 	if err != nil {
 		t.Fatalf("%v", err)
 	}
+	blocks := &file.BlockStore{
+		RootDir: dir + "/testdata/blocks",
+	}
+	chains := &file.ChainStore{
+		RootDir: dir + "/testdata/chains",
+	}
 	srv := &block.Service{
-		ChainStore: &file.ChainStore{
-			RootDir: dir + "/testdata",
+		BlockStore: blocks,
+		ChainStore: chains,
+		Committer: &file.Journal{
+			BlockStore: blocks,
+			ChainStore: chains,
+			RootDir:    dir + "/testdata/journal",
 		},
 	}
 	c1, err := srv.NewChain()
@@ -58,10 +79,17 @@ func TestService(t *testing.T) {
 	if len(c1.Blocks) != 1 {
 		t.Fatalf("expected chain to have 1 block, got %d", len(c1.Blocks))
 	}
-	err = srv.WriteChain(c1)
+	b1, err := srv.NewBlock(c1, []byte("hello"))
 	if err != nil {
 		t.Fatalf("%v", err)
 	}
+	b1A, err := srv.ReadBlock(b1.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(b1A.Data) != "hello" {
+		t.Fatalf("unexpected block data: wanted %s, got %s", "hello", b1A.Data)
+	}
 	c1A, err := srv.ReadChain(c1.Hash)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -69,6 +97,15 @@ func TestService(t *testing.T) {
 	if c1A.Hash != c1.Hash {
 		t.Fatalf("expected loaded chain to have same hash: wanted %s, got %s", c1.Hash, c1A.Hash)
 	}
+	if c1A.LastHash != b1.Hash {
+		t.Fatalf("expected loaded chain to end with the new block: wanted %s, got %s", b1.Hash, c1A.LastHash)
+	}
+	for hash := range c1.Blocks {
+		err = srv.DeleteBlock(hash)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
 	err = srv.DeleteChain(c1.Hash)
 	if err != nil {
 		t.Fatalf("%v", err)
@@ -85,6 +122,7 @@ func TestConcurrentWrites(t *testing.T) {
 		t.Fatalf("%v", err)
 	}
 	s := &block.Service{
+		BlockStore: &memory.BlockStore{},
 		ChainStore: &file.ChainStore{
 			RootDir: dir + "/testdata",
 		},
@@ -137,6 +175,7 @@ func TestConcurrentWrites(t *testing.T) {
 
 func TestBranchingChains(t *testing.T) {
 	s := &block.Service{
+		BlockStore: &memory.BlockStore{},
 		ChainStore: &memory.ChainStore{},
 	}
 	c1, err := s.NewChain()
@@ -158,3 +197,1501 @@ func TestBranchingChains(t *testing.T) {
 		t.Fatalf("expected chain to have branch")
 	}
 }
+
+func TestSignedBlocks(t *testing.T) {
+	signer, err := block.NewKeySigner()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s := &block.Service{
+		BlockStore:      &memory.BlockStore{},
+		ChainStore:      &memory.ChainStore{},
+		SignaturePolicy: block.RequireSigned,
+		Signer:          signer,
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	b1, err := s.NewBlock(c, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(b1.Author) != string(signer.PublicKey()) {
+		t.Fatal("expected block author to be the signer's public key")
+	}
+	err = b1.VerifySignature()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	b2 := c.NewBlock(nil)
+	err = c.AddBlock(b2)
+	if err != block.ErrUnsignedBlock {
+		t.Fatalf("expected %v when adding an unsigned block, got %v", block.ErrUnsignedBlock, err)
+	}
+
+	forger, err := block.NewKeySigner()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b3 := c.NewBlock([]byte("forged"))
+	err = b3.Sign(signer)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b3.Author = forger.PublicKey()
+	err = c.AddBlock(b3)
+	if err != block.ErrInvalidSignature {
+		t.Fatalf("expected %v when adding a forged block, got %v", block.ErrInvalidSignature, err)
+	}
+}
+
+func TestMerkleProofs(t *testing.T) {
+	s := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	items := [][]byte{
+		[]byte("first"),
+		[]byte("second"),
+		[]byte("third"),
+		[]byte("fourth"),
+		[]byte("fifth"),
+	}
+	b, err := s.NewBatchBlock(c, items)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if b.MerkleRoot == "" {
+		t.Fatal("expected batch block to have a merkle root")
+	}
+
+	for i, item := range items {
+		proof, err := b.Proof(i)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		err = proof.Verify(b.MerkleRoot, item)
+		if err != nil {
+			t.Fatalf("failed to verify item %d: %v", i, err)
+		}
+		err = proof.Verify(b.MerkleRoot, []byte("unknown"))
+		if err != block.ErrInvalidProof {
+			t.Fatalf("expected %v when verifying an unknown item, got %v", block.ErrInvalidProof, err)
+		}
+	}
+
+	b2, err := c.NewBatchBlock(items)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b2.Data = block.EncodeItems(items[1:])
+	err = c.AddBlock(b2)
+	if err != block.ErrInvalidMerkleRoot {
+		t.Fatalf("expected %v when data does not match the merkle root, got %v", block.ErrInvalidMerkleRoot, err)
+	}
+	b2.Data = nil
+	err = c.AddBlock(b2)
+	if err != block.ErrInvalidMerkleRoot {
+		t.Fatalf("expected %v when a block without data has a merkle root, got %v", block.ErrInvalidMerkleRoot, err)
+	}
+}
+
+func TestJournalRecovery(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	blocks := &file.BlockStore{
+		RootDir: dir + "/testdata/blocks",
+	}
+	chains := &file.ChainStore{
+		RootDir: dir + "/testdata/chains",
+	}
+	journal := &file.Journal{
+		BlockStore: blocks,
+		ChainStore: chains,
+		RootDir:    dir + "/testdata/journal",
+	}
+
+	c := &block.Chain{
+		Hash: "journal-test",
+	}
+	b := c.NewBlock([]byte("journaled"))
+	err = c.AddBlock(b)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Simulate a crash after the journal entry was written but before the stores were.
+	entry, err := json.Marshal(map[string]interface{}{
+		"Block": b,
+		"Chain": c,
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = os.MkdirAll(journal.RootDir, 0755)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = ioutil.WriteFile(journal.RootDir+"/"+string(c.Hash)+".journal", entry, 0644)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	err = journal.Recover()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = blocks.Read(b.Hash)
+	if err != nil {
+		t.Fatalf("expected journaled block to be recovered: %v", err)
+	}
+	c2, err := chains.Read(c.Hash)
+	if err != nil {
+		t.Fatalf("expected journaled chain to be recovered: %v", err)
+	}
+	if c2.LastHash != b.Hash {
+		t.Fatalf("unexpected chain head: wanted %s, got %s", b.Hash, c2.LastHash)
+	}
+	files, err := ioutil.ReadDir(journal.RootDir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected journal to be empty after recovery, found %d entries", len(files))
+	}
+
+	err = blocks.Delete(b.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = chains.Delete(c.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestFailedCommit(t *testing.T) {
+	s := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	head := c.LastHash
+
+	s.Committer = &failingCommitter{}
+	_, err = s.NewBlock(c, []byte("lost"))
+	if err == nil {
+		t.Fatal("expected an error when the commit fails")
+	}
+	if c.LastHash != head || len(c.Blocks) != 1 {
+		t.Fatal("expected the uncommitted block to be removed from the chain")
+	}
+}
+
+var _ block.Committer = &failingCommitter{}
+
+type failingCommitter struct{}
+
+func (c *failingCommitter) Commit(b *block.Block, ch *block.Chain) error {
+	return errors.New("commit failed")
+}
+
+func TestSegmentStore(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	rootDir := dir + "/testdata/segments"
+	defer os.RemoveAll(rootDir)
+
+	newStore := func() *segment.BlockStore {
+		return &segment.BlockStore{
+			MaxSegmentSize: 1024,
+			RootDir:        rootDir,
+		}
+	}
+	store := newStore()
+	s := &block.Service{
+		BlockStore: store,
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	blocks := make([]*block.Block, 0)
+	for i := 0; i < 20; i++ {
+		b, err := s.NewBlock(c, []byte("segment data"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		blocks = append(blocks, b)
+	}
+	err = store.Delete(blocks[0].Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = store.Close()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	segments, err := filepath.Glob(rootDir + "/*.seg")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expected segments to be rotated, found %d segment", len(segments))
+	}
+
+	verify := func(store *segment.BlockStore) {
+		_, err := store.Read(blocks[0].Hash)
+		if err == nil {
+			t.Fatal("expected an error when reading a deleted block")
+		}
+		for _, b := range blocks[1:] {
+			b2, err := store.Read(b.Hash)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if b2.Hash != b.Hash || string(b2.Data) != string(b.Data) {
+				t.Fatalf("unexpected block read from store: wanted %s, got %s", b.Hash, b2.Hash)
+			}
+		}
+	}
+	store = newStore()
+	verify(store)
+
+	// Simulate a crash with a partially written record and no persisted index.
+	b := c.NewBlock([]byte("torn"))
+	err = c.AddBlock(b)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = store.Write(b)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	segments, err = filepath.Glob(rootDir + "/*.seg")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	last := segments[len(segments)-1]
+	info, err := os.Stat(last)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = os.Truncate(last, info.Size()-3)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = os.Remove(rootDir + "/index")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	store = newStore()
+	verify(store)
+	_, err = store.Read(b.Hash)
+	if err == nil {
+		t.Fatal("expected the torn block to be discarded during recovery")
+	}
+	err = store.Write(b)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = store.Read(b.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = store.Close()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestBranchHistory(t *testing.T) {
+	s := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c1, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	genesis := c1.LastHash
+	b1, err := s.NewBlock(c1, []byte("one"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b2, err := s.NewBlock(c1, []byte("two"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	branch, err := s.NewBranch(c1, b1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	c2, err := s.ReadChain(branch.ToChain)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	branchGenesis := c2.LastHash
+	b3, err := s.NewBlock(c2, []byte("three"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	lineage, err := s.Lineage(c2.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(lineage) != 2 || lineage[0].Hash != c1.Hash || lineage[1].Hash != c2.Hash {
+		t.Fatal("expected branched chain's lineage to start with its parent")
+	}
+
+	expectHistory := func(hash block.ChainHash, expected []block.Hash) {
+		history, err := s.History(hash)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(history) != len(expected) {
+			t.Fatalf("unexpected history length: wanted %d, got %d", len(expected), len(history))
+		}
+		for i := range expected {
+			if history[i] != expected[i] {
+				t.Fatalf("unexpected block at position %d: wanted %s, got %s", i, expected[i], history[i])
+			}
+		}
+	}
+	expectHistory(c2.Hash, []block.Hash{genesis, b1.Hash, branchGenesis, b3.Hash})
+
+	descendants, err := s.Descendants(c1, b1.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(descendants) != 1 || descendants[0].Hash != branch.Hash {
+		t.Fatalf("expected branch to descend from block %s", b1.Hash)
+	}
+	descendants, err = s.Descendants(c1, b2.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(descendants) != 0 {
+		t.Fatalf("expected no branches to descend from block %s", b2.Hash)
+	}
+
+	merge, err := s.MergeBranch(c1, branch.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if merge.PreviousHash != b2.Hash || merge.MergeHash != b3.Hash {
+		t.Fatal("expected merge block to reference both chain heads")
+	}
+	_, err = s.MergeBranch(c1, branch.Hash)
+	if err != block.ErrBranchMerged {
+		t.Fatalf("expected %v when merging a branch twice, got %v", block.ErrBranchMerged, err)
+	}
+	expectHistory(c1.Hash, []block.Hash{genesis, b1.Hash, b2.Hash, branchGenesis, b3.Hash, merge.Hash})
+}
+
+func TestPruning(t *testing.T) {
+	blocks := &memory.BlockStore{}
+	s := &block.Service{
+		BlockStore:    blocks,
+		ChainStore:    &memory.ChainStore{},
+		SnapshotStore: &memory.SnapshotStore{},
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	hashes := []block.Hash{c.LastHash}
+	for i := 0; i < 5; i++ {
+		b, err := s.NewBlock(c, []byte("data"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		hashes = append(hashes, b.Hash)
+	}
+
+	_, err = s.NewSnapshot(c, 3, []byte("state"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = s.Prune(c)
+	if err != block.ErrArchivalMode {
+		t.Fatalf("expected %v when pruning an archival node, got %v", block.ErrArchivalMode, err)
+	}
+
+	s.Mode = block.Pruned
+	snapshot, err := s.NewSnapshot(c, 3, []byte("state"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if snapshot.Hash != hashes[3] || snapshot.Head != c.LastHash {
+		t.Fatal("expected snapshot to reference the block at its index and the chain's head")
+	}
+	for i, hash := range hashes {
+		_, err := blocks.Read(hash)
+		if i < 3 {
+			if err == nil {
+				t.Fatalf("expected block %d to be pruned", i)
+			}
+			if !c.Pruned(hash) {
+				t.Fatalf("expected chain to report block %d as pruned", i)
+			}
+		} else if err != nil {
+			t.Fatalf("expected block %d to be kept: %v", i, err)
+		}
+	}
+	if len(c.Blocks) != len(hashes) {
+		t.Fatal("expected chain to keep the hashes of pruned blocks")
+	}
+}
+
+func TestArchive(t *testing.T) {
+	signer, err := block.NewKeySigner()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s1 := &block.Service{
+		BlockStore:      &memory.BlockStore{},
+		ChainStore:      &memory.ChainStore{},
+		SignaturePolicy: block.RequireSigned,
+		Signer:          signer,
+	}
+	c1, err := s1.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b1, err := s1.NewBlock(c1, []byte("one"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = s1.NewBlock(c1, []byte("two"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	branch, err := s1.NewBranch(c1, b1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var buf bytes.Buffer
+	err = s1.Export(&buf, c1.Hash, &block.ExportOptions{
+		Branches: true,
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	archive := buf.Bytes()
+
+	s2 := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c2, err := s2.Import(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if c2.Hash != c1.Hash || c2.LastHash != c1.LastHash || len(c2.Blocks) != len(c1.Blocks) {
+		t.Fatal("expected imported chain to match the exported chain")
+	}
+	b1A, err := s2.ReadBlock(b1.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(b1A.Data) != "one" {
+		t.Fatalf("unexpected block data: wanted %s, got %s", "one", b1A.Data)
+	}
+	_, err = s2.ReadChain(branch.ToChain)
+	if err != nil {
+		t.Fatalf("expected branched chain to be imported: %v", err)
+	}
+	_, err = s2.Import(bytes.NewReader(archive))
+	if err != block.ErrChainExists {
+		t.Fatalf("expected %v when importing an existing chain, got %v", block.ErrChainExists, err)
+	}
+
+	// An archive cannot relax the signature policy of the importing service.
+	unsigned := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c4, err := unsigned.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var unsignedBuf bytes.Buffer
+	err = unsigned.Export(&unsignedBuf, c4.Hash, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = s1.Import(bytes.NewReader(unsignedBuf.Bytes()))
+	if err != block.ErrUnsignedBlock {
+		t.Fatalf("expected %v when importing unsigned blocks, got %v", block.ErrUnsignedBlock, err)
+	}
+
+	oversized := append([]byte("XZORCHAIN"), 1, 0xff, 0xff, 0xff, 0xff)
+	_, err = s2.Import(bytes.NewReader(oversized))
+	if err != block.ErrInvalidArchive {
+		t.Fatalf("expected %v for an oversized archive record, got %v", block.ErrInvalidArchive, err)
+	}
+
+	tampered := make([]byte, len(archive))
+	copy(tampered, archive)
+	i := bytes.Index(tampered, []byte("dHdv")) // base64 encoding of "two"
+	tampered[i] = 'T'
+	s3 := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	_, err = s3.Import(bytes.NewReader(tampered))
+	if err == nil {
+		t.Fatal("expected an error when importing a tampered archive")
+	}
+	_, err = s3.ReadChain(c1.Hash)
+	if err == nil {
+		t.Fatal("expected nothing to be imported from a tampered archive")
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	s := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b1, err := s.NewBlock(c, []byte("one"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b2, err := s.NewBlock(c, []byte("two"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	sub, err := s.Subscribe(c, 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer sub.Close()
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 10; i++ {
+			_, err := s.NewBlock(c, []byte("more"))
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+		_, err := s.NewBranch(c, b1)
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- nil
+	}()
+
+	expected := []block.Hash{b1.Hash, b2.Hash}
+	for i := 0; i < 12; i++ {
+		e := <-sub.Events()
+		if e.Type != block.BlockAppended {
+			t.Fatalf("unexpected event type: wanted %d, got %d", block.BlockAppended, e.Type)
+		}
+		if i < len(expected) && e.Block.Hash != expected[i] {
+			t.Fatalf("unexpected replayed block: wanted %s, got %s", expected[i], e.Block.Hash)
+		}
+		if e.Block.Index != block.Index(i+1) {
+			t.Fatalf("expected blocks in order: wanted index %d, got %d", i+1, e.Block.Index)
+		}
+	}
+	e := <-sub.Events()
+	if e.Type != block.BranchCreated {
+		t.Fatalf("unexpected event type: wanted %d, got %d", block.BranchCreated, e.Type)
+	}
+	err = <-done
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	err = s.Rewind(c, b1.PreviousHash)
+	if err == nil {
+		t.Fatal("expected an error when rewinding past a branch")
+	}
+	head := c.LastHash
+	sub2, err := s.Subscribe(c, 100)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer sub2.Close()
+	_, err = s.NewBlock(c, []byte("fork"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	<-sub2.Events()
+	err = s.Rewind(c, head)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	e = <-sub2.Events()
+	if e.Type != block.Reorg || e.Head != head {
+		t.Fatal("expected a reorg event moving the head back")
+	}
+}
+
+func TestListChains(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	stores := map[string]block.ChainStore{
+		"memory": &memory.ChainStore{},
+		"file": &file.ChainStore{
+			RootDir: dir + "/testdata/list",
+		},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := &block.Service{
+				BlockStore: &memory.BlockStore{},
+				ChainStore: store,
+			}
+			chains := make(map[block.ChainHash]*block.Chain)
+			for i := 0; i < 5; i++ {
+				c, err := s.NewChain()
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				chains[c.Hash] = c
+				defer s.DeleteChain(c.Hash)
+			}
+
+			listed := make([]*block.ChainInfo, 0)
+			var after block.ChainHash
+			for {
+				page, err := s.ListChains(after, 2)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				if len(page) > 2 {
+					t.Fatalf("expected at most 2 chains per page, got %d", len(page))
+				}
+				listed = append(listed, page...)
+				after = page[len(page)-1].Hash
+			}
+			if len(listed) != len(chains) {
+				t.Fatalf("unexpected number of chains listed: wanted %d, got %d", len(chains), len(listed))
+			}
+			for i, info := range listed {
+				c := chains[info.Hash]
+				if c == nil {
+					t.Fatalf("unexpected chain listed: %s", info.Hash)
+				}
+				if i > 0 && listed[i-1].Hash >= info.Hash {
+					t.Fatal("expected chains to be listed in order")
+				}
+				if info.Head != c.LastHash || info.Created == 0 {
+					t.Fatal("expected chain info to describe the chain")
+				}
+			}
+
+			c := chains[listed[2].Hash]
+			err = s.DescribeChain(c, "described")
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			b, err := s.NewBlock(c, nil)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			branch, err := s.NewBranch(c, b)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer s.DeleteChain(branch.ToChain)
+
+			found, err := s.FindChains(&block.ChainQuery{
+				Description: "described",
+			})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if len(found) != 1 || found[0].Hash != c.Hash || found[0].Height != 1 {
+				t.Fatal("expected to find the described chain")
+			}
+			found, err = s.FindChains(&block.ChainQuery{
+				Parent: c.Hash,
+			})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if len(found) != 1 || found[0].Hash != branch.ToChain {
+				t.Fatal("expected to find the branched chain by its parent")
+			}
+		})
+	}
+}
+
+func TestLightStore(t *testing.T) {
+	full := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := full.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := full.NewBlock(c, []byte("full data"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	headers := &memory.HeaderStore{}
+	light := &block.Service{
+		BlockStore: &block.LightStore{
+			Fetcher: full,
+			Headers: headers,
+		},
+		ChainStore: &memory.ChainStore{},
+	}
+	lc := &block.Chain{
+		Hash:             c.Hash,
+		TimestampVersion: c.TimestampVersion,
+	}
+	for _, hash := range c.Hashes() {
+		b, err := full.ReadBlock(hash)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		h, err := b.Header()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		err = light.AddHeader(lc, h)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if lc.LastHash != c.LastHash {
+		t.Fatal("expected light chain to follow the full chain's headers")
+	}
+
+	b, err := light.ReadBlock(c.LastHash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(b.Data) != "full data" {
+		t.Fatalf("unexpected block data: wanted %s, got %s", "full data", b.Data)
+	}
+
+	forged, err := full.ReadBlock(c.LastHash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	forged.Data = []byte("forged data")
+	err = full.WriteBlock(forged)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = light.ReadBlock(c.LastHash)
+	if err != block.ErrInvalidBody {
+		t.Fatalf("expected %v when fetching a forged block, got %v", block.ErrInvalidBody, err)
+	}
+
+	h, err := headers.Read(c.LastHash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.PreviousHash = "bad_hash"
+	err = (&block.Chain{LastHash: "bad_hash"}).AddHeader(h)
+	if err != block.ErrInvalidHash {
+		t.Fatalf("expected %v when adding a tampered header, got %v", block.ErrInvalidHash, err)
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	blocks := &memory.BlockStore{}
+	s := &block.Service{
+		BlockStore: blocks,
+		ChainStore: &memory.ChainStore{},
+	}
+	c1, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b1, err := s.NewBlock(c1, []byte("kept"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	branch, err := s.NewBranch(c1, b1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	c2, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b2, err := s.NewBlock(c2, []byte("deleted"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = s.DeleteChain(c2.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	unlinked := &block.Block{
+		Data:      []byte("unlinked"),
+		Hash:      "unlinked",
+		Timestamp: 1,
+	}
+	err = s.WriteBlock(unlinked)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	report, err := s.CollectGarbage(&block.GarbageOptions{
+		DryRun: true,
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if report.Chains != 2 || len(report.Orphans) != 2 || report.Orphans[0] != b2.Hash || len(report.Pending) != 0 {
+		t.Fatalf("unexpected dry run report: %d chains walked, %d orphans found", report.Chains, len(report.Orphans))
+	}
+	for _, hash := range report.Orphans {
+		_, err := s.ReadBlock(hash)
+		if err != nil {
+			t.Fatal("expected a dry run to leave orphaned blocks in place")
+		}
+	}
+
+	_, err = s.CollectGarbage(nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, hash := range report.Orphans {
+		_, err := s.ReadBlock(hash)
+		if err == nil {
+			t.Fatalf("expected orphaned block %s to be collected", hash)
+		}
+	}
+	history, err := s.History(branch.ToChain)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, hash := range history {
+		_, err := s.ReadBlock(hash)
+		if err != nil {
+			t.Fatalf("expected reachable block %s to be kept", hash)
+		}
+	}
+}
+
+func TestCollectGarbageDuringCommit(t *testing.T) {
+	clock := &testClock{
+		now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	blocks := &collectingBlockStore{}
+	s := &block.Service{
+		BlockStore: blocks,
+		ChainStore: &memory.ChainStore{},
+		Clock:      clock,
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// The block is created long before it is added, as if it had been synced from a peer.
+	b := c.NewBlock([]byte("synced"))
+	clock.now = clock.now.Add(24 * time.Hour)
+
+	var report *block.GarbageReport
+	blocks.collect = func() {
+		blocks.collect = nil
+		report, err = s.CollectGarbage(nil)
+	}
+	err = s.AddBlock(c, b)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if report == nil || len(report.Pending) != 1 || report.Pending[0] != b.Hash || len(report.Orphans) != 0 {
+		t.Fatal("expected a block being committed to be kept by a concurrent collection")
+	}
+	_, err = s.ReadBlock(b.Hash)
+	if err != nil {
+		t.Fatal("expected the committed block to be kept")
+	}
+}
+
+// collectingBlockStore runs collect after writing a block, before its chain is written.
+type collectingBlockStore struct {
+	memory.BlockStore
+	collect func()
+}
+
+func (s *collectingBlockStore) Write(b *block.Block) error {
+	err := s.BlockStore.Write(b)
+	if err == nil && s.collect != nil {
+		s.collect()
+	}
+	return err
+}
+
+func TestPayloads(t *testing.T) {
+	s := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b, err := s.NewPayloadBlock(c, &block.Payload{
+		Data:     []byte("hello"),
+		Encoding: block.EncodingRaw,
+		Type:     "test.greeting",
+		Version:  2,
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	p, err := b.Payload()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if p.Type != "test.greeting" || p.Version != 2 || p.Encoding != block.EncodingRaw || string(p.Data) != "hello" {
+		t.Fatal("expected payload to match the one written to the block")
+	}
+
+	r := &block.PayloadRegistry{}
+	_, err = r.Decode(b.Data)
+	if err != block.ErrUnknownPayload {
+		t.Fatalf("expected ErrUnknownPayload, got %v", err)
+	}
+	decoder := block.PayloadDecoderFunc(func(p *block.Payload) (interface{}, error) {
+		return string(p.Data), nil
+	})
+	err = r.Register("test.greeting", decoder)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = r.Register("test.greeting", decoder)
+	if err != block.ErrPayloadRegistered {
+		t.Fatalf("expected ErrPayloadRegistered, got %v", err)
+	}
+	v, err := r.Decode(b.Data)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if v != "hello" {
+		t.Fatalf("unexpected decoded payload: %v", v)
+	}
+
+	untyped, err := s.NewBlock(c, []byte("hello"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = r.Decode(untyped.Data)
+	if err != block.ErrUntypedPayload {
+		t.Fatalf("expected ErrUntypedPayload, got %v", err)
+	}
+}
+
+func TestChainManager(t *testing.T) {
+	m := &block.Manager{
+		Service: &block.Service{
+			BlockStore: &memory.BlockStore{},
+			ChainStore: &memory.ChainStore{},
+		},
+	}
+	chains := make([]*block.Chain, 3)
+	for i := range chains {
+		c, err := m.NewChain()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		chains[i] = c
+	}
+
+	// Half of the writers append blindly while the other half retry compare-and-append
+	// until their expected head is still current.
+	writers := 8
+	writesPerWriter := 20
+	errs := make(chan error)
+	for _, c := range chains {
+		for i := 0; i < writers; i++ {
+			go func(hash block.ChainHash, optimistic bool) {
+				for j := 0; j < writesPerWriter; j++ {
+					if !optimistic {
+						_, err := m.Append(hash, []byte("blind"))
+						if err != nil {
+							errs <- err
+							return
+						}
+						continue
+					}
+					for {
+						head, err := m.Head(hash)
+						if err != nil {
+							errs <- err
+							return
+						}
+						_, err = m.CompareAndAppend(hash, head, []byte("optimistic"))
+						if err == block.ErrHeadMismatch {
+							continue
+						}
+						if err != nil {
+							errs <- err
+							return
+						}
+						break
+					}
+				}
+				errs <- nil
+			}(c.Hash, i%2 == 0)
+		}
+	}
+	genesis, err := m.Service.ReadBlock(chains[0].Hashes()[0])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	go func() {
+		_, err := m.NewBranch(chains[0].Hash, genesis)
+		errs <- err
+	}()
+	for i := 0; i < len(chains)*writers+1; i++ {
+		err := <-errs
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	expectedBlocks := writers*writesPerWriter + 1
+	for _, c := range chains {
+		stored, err := m.Service.ReadChain(c.Hash)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(stored.Blocks) != expectedBlocks || stored.LastHash != c.LastHash {
+			t.Fatalf("unexpected number of blocks: wanted %d, got %d", expectedBlocks, len(stored.Blocks))
+		}
+		if stored == c {
+			t.Fatal("expected the chain store to return a copy of the chain")
+		}
+		loaded, err := m.Chain(c.Hash)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if loaded != c {
+			t.Fatal("expected the manager to share a single instance of the chain")
+		}
+	}
+	if len(chains[0].Branches) != 1 {
+		t.Fatal("expected a branch from the genesis block")
+	}
+
+	_, err = m.CompareAndAppend(chains[1].Hash, chains[1].Hashes()[0], nil)
+	if err != block.ErrHeadMismatch {
+		t.Fatalf("expected ErrHeadMismatch, got %v", err)
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	clock := &testClock{
+		now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	s := &block.Service{
+		BlockStore:   &memory.BlockStore{},
+		ChainStore:   &memory.ChainStore{},
+		Clock:        clock,
+		MaxClockSkew: time.Second,
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	clock.now = clock.now.Add(1500 * time.Microsecond)
+	b1, err := s.NewBlock(c, []byte("one"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if b1.Timestamp != block.Timestamp(clock.now) || b1.Timestamp%1000 != 1 {
+		t.Fatalf("expected a millisecond timestamp from the injected clock, got %d", b1.Timestamp)
+	}
+
+	// A clock that moves backwards still produces blocks the chain accepts.
+	clock.now = clock.now.Add(-100 * time.Millisecond)
+	b2, err := s.NewBlock(c, []byte("two"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if b2.Timestamp != b1.Timestamp {
+		t.Fatal("expected the block timestamp to be clamped to the chain's last timestamp")
+	}
+	clock.now = clock.now.Add(100 * time.Millisecond)
+
+	earlier := c.NewBlock(nil)
+	earlier.Timestamp = b2.Timestamp - 1
+	err = c.AddBlock(earlier)
+	if err != block.ErrInvalidTimestamp {
+		t.Fatalf("expected ErrInvalidTimestamp for a decreasing timestamp, got %v", err)
+	}
+	future := c.NewBlock(nil)
+	future.Timestamp = block.Timestamp(clock.now.Add(2 * time.Second))
+	err = c.AddBlock(future)
+	if err != block.ErrInvalidTimestamp {
+		t.Fatalf("expected ErrInvalidTimestamp for a timestamp beyond the allowed skew, got %v", err)
+	}
+	skewed := c.NewBlock(nil)
+	skewed.Timestamp = block.Timestamp(clock.now.Add(500 * time.Millisecond))
+	err = c.AddBlock(skewed)
+	if err != nil {
+		t.Fatalf("expected a timestamp within the allowed skew to be accepted: %v", err)
+	}
+
+	stored, err := s.ReadChain(c.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if stored.Clock != clock || stored.LastTimestamp != b2.Timestamp {
+		t.Fatal("expected chains read by the service to use its clock and keep their last timestamp")
+	}
+	if stored.TimestampVersion != block.MillisecondTimestamps {
+		t.Fatal("expected new chains to use millisecond timestamps")
+	}
+
+	// Chains stored before timestamps had millisecond precision keep using seconds.
+	legacy := &block.Chain{
+		Blocks:   make(map[block.Hash]block.Index),
+		Branches: make(map[block.BranchHash]*block.Branch),
+		Clock:    clock,
+		Hash:     "legacy",
+	}
+	b3 := legacy.NewBlock([]byte("three"))
+	if b3.Timestamp != clock.now.Unix() {
+		t.Fatalf("expected a timestamp in seconds on a legacy chain, got %d", b3.Timestamp)
+	}
+	err = legacy.AddBlock(b3)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	future = legacy.NewBlock(nil)
+	future.Timestamp = clock.now.Add(2 * time.Minute).Unix()
+	err = legacy.AddBlock(future)
+	if err != block.ErrInvalidTimestamp {
+		t.Fatalf("expected ErrInvalidTimestamp for a legacy timestamp beyond the allowed skew, got %v", err)
+	}
+}
+
+var _ block.Clock = &testClock{}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func TestInterruptedFileWrites(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	rootDir := dir + "/testdata/interrupted"
+	defer os.RemoveAll(rootDir)
+	blocks := &file.BlockStore{
+		RootDir: rootDir + "/blocks",
+	}
+	chains := &file.ChainStore{
+		RootDir: rootDir + "/chains",
+	}
+	s := &block.Service{
+		BlockStore: blocks,
+		ChainStore: chains,
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	info, err := os.Stat(chains.RootDir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Fatalf("unexpected directory permissions: %v", info.Mode().Perm())
+	}
+
+	// Crashes while replacing the chain and writing a block leave partial temporary files behind.
+	partials := []string{
+		chains.RootDir + "/" + string(c.Hash) + ".123456.tmp",
+		blocks.RootDir + "/" + string(c.LastHash) + ".123456.tmp",
+	}
+	for _, filename := range partials {
+		err = ioutil.WriteFile(filename, []byte("{\"Bl"), 0644)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	stored, err := s.ReadChain(c.Hash)
+	if err != nil {
+		t.Fatalf("expected the previous chain to survive an interrupted write: %v", err)
+	}
+	if stored.LastHash != c.LastHash {
+		t.Fatal("unexpected chain read after an interrupted write")
+	}
+	infos, err := s.ListChains("", 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	hashes, err := blocks.Hashes()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(infos) != 1 || len(hashes) != 1 {
+		t.Fatal("expected temporary files to be excluded from listings")
+	}
+
+	err = blocks.Recover()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = chains.Recover()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, filename := range partials {
+		_, err = os.Stat(filename)
+		if !os.IsNotExist(err) {
+			t.Fatalf("expected recovery to remove %s", filename)
+		}
+	}
+}
+
+func TestBlockCache(t *testing.T) {
+	blocks := &cache.BlockStore{
+		Cache: &common.LRU{MaxEntries: 2},
+		Store: &memory.BlockStore{},
+	}
+	s := &block.Service{
+		BlockStore: blocks,
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b1, err := s.NewBlock(c, []byte("one"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	read, err := s.ReadBlock(b1.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	read.Data[0] = 'x'
+	b1.Data[1] = 'x'
+	read, err = s.ReadBlock(b1.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(read.Data) != "one" {
+		t.Fatal("expected cached blocks to be unaffected by changes to blocks read from the cache")
+	}
+	if stats := blocks.Stats(); stats.Hits != 2 || stats.Misses != 0 {
+		t.Fatalf("expected written blocks to be read from the cache, got %+v", stats)
+	}
+
+	_, err = s.NewBlock(c, []byte("two"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = s.NewBlock(c, []byte("three"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = s.ReadBlock(b1.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if stats := blocks.Stats(); stats.Misses != 1 || stats.Evictions != 3 {
+		t.Fatalf("expected evicted blocks to be read from the store, got %+v", stats)
+	}
+
+	report, err := s.CollectGarbage(&block.GarbageOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if report.Live != 4 {
+		t.Fatalf("expected garbage collection to list the cached store's blocks, got %d live blocks", report.Live)
+	}
+	err = blocks.Delete(b1.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = s.ReadBlock(b1.Hash)
+	if err == nil {
+		t.Fatal("expected deleted blocks to be dropped from the cache")
+	}
+}
+
+func TestEncryptedBlocks(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	kr := &encryption.FileKeyring{
+		Dir: dir + "/testdata/keyring",
+	}
+	defer os.RemoveAll(kr.Dir)
+	plain := &memory.BlockStore{}
+	blocks := &encrypted.BlockStore{
+		Keyring: kr,
+		Store:   plain,
+	}
+	s := &block.Service{
+		BlockStore: blocks,
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b, err := s.NewBlock(c, []byte("secret"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	stored, err := plain.Read(b.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if bytes.Contains(stored.Data, []byte("secret")) || stored.PreviousHash != b.PreviousHash {
+		t.Fatal("expected only the block's data to be encrypted at rest")
+	}
+	read, err := s.ReadBlock(b.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(read.Data) != "secret" {
+		t.Fatalf("unexpected block data: %s", read.Data)
+	}
+
+	rot, err := encryption.Rotate(kr, []encryption.Reencrypter{blocks})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	n, err := rot.Wait()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected both blocks to be resealed, got %d", n)
+	}
+	stored, err = plain.Read(b.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if keyID, err := encryption.SealedKeyID(stored.Data); err != nil || keyID != rot.KeyID {
+		t.Fatal("expected the block to be sealed with the new key")
+	}
+	read, err = s.ReadBlock(b.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(read.Data) != "secret" {
+		t.Fatal("expected resealed blocks to be readable")
+	}
+
+	// Blocks written before encryption was enabled are read and resealed when plaintext is allowed.
+	legacy := &block.Block{
+		Data:      []byte("legacy"),
+		Hash:      "legacy",
+		Timestamp: 1,
+	}
+	err = plain.Write(legacy)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = blocks.Read(legacy.Hash)
+	if err != encryption.ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted for plaintext blocks, got %v", err)
+	}
+	blocks.AllowPlaintext = true
+	read, err = blocks.Read(legacy.Hash)
+	if err != nil || string(read.Data) != "legacy" {
+		t.Fatal("expected plaintext blocks to be readable when allowed")
+	}
+	n, err = blocks.Reencrypt()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	stored, err = plain.Read(legacy.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if n != 1 || !encryption.IsSealed(stored.Data) {
+		t.Fatal("expected plaintext blocks to be sealed by Reencrypt")
+	}
+}
+
+func TestRewindMergedBranch(t *testing.T) {
+	s := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := s.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b1, err := s.NewBlock(c, []byte("one"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	branch, err := s.NewBranch(c, b1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = s.MergeBranch(c, branch.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = s.Rewind(c, b1.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	stored, err := s.ReadChain(c.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if stored.Branches[branch.Hash].MergeBlock != "" {
+		t.Fatal("expected rewinding past a merge block to unmerge its branch")
+	}
+	_, err = s.MergeBranch(c, branch.Hash)
+	if err != nil {
+		t.Fatalf("expected the branch to be merged again: %v", err)
+	}
+}
@@ -0,0 +1,427 @@
+package blocksync
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+	"github.com/xzor-dev/xzor/internal/xzor/network"
+)
+
+// DefaultBatchSize is the number of blocks requested at once when a syncer does not provide a batch size.
+const DefaultBatchSize = 100
+
+// DefaultRetryInterval is how long a syncer waits for requested blocks before requesting them again.
+const DefaultRetryInterval = 10 * time.Second
+
+// DefaultMaxSeen is the number of message IDs a syncer remembers when it does not provide a limit.
+const DefaultMaxSeen = 10000
+
+// MessageType identifies the purpose of a sync message.
+type MessageType string
+
+const (
+	// HeadsMessage advertises the heads of the sender's chains.
+	HeadsMessage MessageType = "heads"
+
+	// RequestMessage requests blocks from a chain by index range or by hash.
+	RequestMessage MessageType = "request"
+
+	// BlocksMessage holds blocks sent in response to a request.
+	BlocksMessage MessageType = "blocks"
+)
+
+// Head describes the head of a chain.
+type Head struct {
+	Chain block.ChainHash
+	Hash  block.Hash
+	Index block.Index
+}
+
+// Message is exchanged between syncers.
+// Requests set either Hashes or the inclusive index range From and To.
+type Message struct {
+	Blocks []*block.Block
+	Chain  block.ChainHash
+	From   block.Index
+	Hashes []block.Hash
+	Heads  []*Head
+	ID     string
+	To     block.Index
+	Type   MessageType
+}
+
+// Sender sends encoded messages to peers.
+type Sender interface {
+	Send([]byte) error
+}
+
+var _ Sender = &network.Node{}
+var _ network.DataHandler = &Syncer{}
+var _ block.BodyFetcher = &Syncer{}
+
+// Syncer keeps chains up to date with the chains of its peers.
+//
+// Syncers advertise the heads of the chains they follow. A syncer receiving a head beyond
+// its own requests the missing blocks from its local height onwards in batches, validates
+// and commits them through the block service, then requests the next batch. Progress is
+// the committed height of each chain, so syncing resumes where it left off after a
+// disconnect as soon as a peer advertises its heads again.
+//
+// The IDs of the most recent MaxSeen messages are remembered so duplicates are ignored.
+type Syncer struct {
+	BatchSize     int
+	MaxSeen       int
+	RetryInterval time.Duration
+	Sender        Sender
+	Service       *block.Service
+
+	chains    map[block.ChainHash]*block.Chain
+	fetches   map[block.Hash][]chan *block.Block
+	mux       sync.Mutex
+	remote    map[block.ChainHash]block.Index
+	requested map[block.ChainHash]*request
+	seen      *common.LRU
+}
+
+// request tracks the blocks requested for a chain.
+type request struct {
+	from block.Index
+	time time.Time
+}
+
+// Advertise sends the heads of every followed chain to peers.
+func (s *Syncer) Advertise() error {
+	s.mux.Lock()
+	heads := make([]*Head, 0, len(s.chains))
+	for _, c := range s.chains {
+		info := c.Info()
+		heads = append(heads, &Head{
+			Chain: info.Hash,
+			Hash:  info.Head,
+			Index: info.Height,
+		})
+	}
+	s.mux.Unlock()
+	sort.Slice(heads, func(i, j int) bool {
+		return heads[i].Chain < heads[j].Chain
+	})
+
+	return s.send(&Message{
+		Heads: heads,
+		Type:  HeadsMessage,
+	})
+}
+
+// FetchBlock requests a block from peers by its hash and waits for it to arrive.
+// Light nodes use it to fetch the data of blocks they only hold the headers of.
+// The returned block should be verified by the caller, as LightStore does.
+func (s *Syncer) FetchBlock(hash block.Hash) (*block.Block, error) {
+	ch := make(chan *block.Block, 1)
+	s.mux.Lock()
+	s.init()
+	s.fetches[hash] = append(s.fetches[hash], ch)
+	s.mux.Unlock()
+
+	defer func() {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		fetches := s.fetches[hash]
+		for i, f := range fetches {
+			if f == ch {
+				s.fetches[hash] = append(fetches[:i], fetches[i+1:]...)
+				break
+			}
+		}
+		if len(s.fetches[hash]) == 0 {
+			delete(s.fetches, hash)
+		}
+	}()
+
+	err := s.Request("", []block.Hash{hash})
+	if err != nil {
+		return nil, err
+	}
+	// Prefer a block that was delivered while the request was being sent.
+	select {
+	case b := <-ch:
+		return b, nil
+	default:
+	}
+	select {
+	case b := <-ch:
+		return b, nil
+	case <-time.After(s.retryInterval()):
+		return nil, fmt.Errorf("timed out fetching block %s", hash)
+	}
+}
+
+// Follow adds a chain to the syncer. Chains that do not exist locally
+// are created empty and filled in from the blocks of peers.
+func (s *Syncer) Follow(hash block.ChainHash) (*block.Chain, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.init()
+	if c := s.chains[hash]; c != nil {
+		return c, nil
+	}
+	c, err := s.Service.ReadChain(hash)
+	if err == block.ErrChainNotFound {
+		c = s.Service.NewEmptyChain(hash)
+	} else if err != nil {
+		return nil, err
+	}
+	s.chains[hash] = c
+	return c, nil
+}
+
+// HandleData handles sync messages received from peers.
+// Messages are never relayed since each syncer responds to them directly.
+func (s *Syncer) HandleData(data []byte) error {
+	msg := &Message{}
+	err := json.Unmarshal(data, msg)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	s.init()
+	if _, ok := s.seen.Get(msg.ID); ok {
+		s.mux.Unlock()
+		return network.ErrNoRelay
+	}
+	s.seen.Add(msg.ID, true, 0)
+	s.mux.Unlock()
+
+	switch msg.Type {
+	case HeadsMessage:
+		err = s.handleHeads(msg)
+	case RequestMessage:
+		err = s.handleRequest(msg)
+	case BlocksMessage:
+		err = s.handleBlocks(msg)
+	default:
+		err = fmt.Errorf("unknown sync message type: %s", msg.Type)
+	}
+	if err != nil {
+		return err
+	}
+	return network.ErrNoRelay
+}
+
+// Request asks peers for blocks by their hashes.
+// Blocks requested without a chain hash are not added to any chain.
+func (s *Syncer) Request(hash block.ChainHash, hashes []block.Hash) error {
+	return s.send(&Message{
+		Chain:  hash,
+		Hashes: hashes,
+		Type:   RequestMessage,
+	})
+}
+
+// RequestRange asks peers for the blocks of a chain within an inclusive index range.
+func (s *Syncer) RequestRange(hash block.ChainHash, from, to block.Index) error {
+	return s.send(&Message{
+		Chain: hash,
+		From:  from,
+		To:    to,
+		Type:  RequestMessage,
+	})
+}
+
+// handleBlocks validates and commits received blocks in order, then requests the next batch.
+func (s *Syncer) handleBlocks(msg *Message) error {
+	s.mux.Lock()
+	for _, b := range msg.Blocks {
+		for _, ch := range s.fetches[b.Hash] {
+			select {
+			case ch <- b:
+			default:
+			}
+		}
+	}
+	s.mux.Unlock()
+
+	c := s.chain(msg.Chain)
+	if c == nil {
+		return nil
+	}
+	blocks := msg.Blocks
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Index < blocks[j].Index
+	})
+	for _, b := range blocks {
+		if c.Has(b.Hash) {
+			continue
+		}
+		err := s.Service.AddBlock(c, b)
+		if err != nil {
+			return fmt.Errorf("failed to sync block %s: %v", b.Hash, err)
+		}
+	}
+
+	s.mux.Lock()
+	delete(s.requested, msg.Chain)
+	s.mux.Unlock()
+	return s.requestMissing(c)
+}
+
+// handleHeads requests the blocks of followed chains that peers are ahead on.
+func (s *Syncer) handleHeads(msg *Message) error {
+	for _, head := range msg.Heads {
+		c := s.chain(head.Chain)
+		if c == nil {
+			continue
+		}
+		s.mux.Lock()
+		if head.Index > s.remote[head.Chain] {
+			s.remote[head.Chain] = head.Index
+		}
+		s.mux.Unlock()
+
+		err := s.requestMissing(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleRequest responds with the requested blocks of a followed chain,
+// or with blocks requested by hash alone.
+func (s *Syncer) handleRequest(msg *Message) error {
+	hashes := msg.Hashes
+	if msg.Chain != "" {
+		c := s.chain(msg.Chain)
+		if c == nil {
+			return nil
+		}
+		if len(hashes) == 0 {
+			hashes = c.Range(msg.From, msg.To)
+		}
+	}
+	if len(hashes) > s.batchSize() {
+		hashes = hashes[:s.batchSize()]
+	}
+
+	blocks := make([]*block.Block, 0, len(hashes))
+	for _, h := range hashes {
+		b, err := s.Service.ReadBlock(h)
+		if err != nil {
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	return s.send(&Message{
+		Blocks: blocks,
+		Chain:  msg.Chain,
+		Type:   BlocksMessage,
+	})
+}
+
+// requestMissing requests the next batch of blocks for a chain that peers are ahead on,
+// unless a request for the same blocks is still pending.
+func (s *Syncer) requestMissing(c *block.Chain) error {
+	info := c.Info()
+	from := info.Height + 1
+	if info.Head == "" {
+		from = 0
+	}
+
+	s.mux.Lock()
+	remote := s.remote[info.Hash]
+	if remote < from {
+		s.mux.Unlock()
+		return nil
+	}
+	req := s.requested[info.Hash]
+	if req != nil && req.from == from && time.Since(req.time) < s.retryInterval() {
+		s.mux.Unlock()
+		return nil
+	}
+	s.requested[info.Hash] = &request{
+		from: from,
+		time: time.Now(),
+	}
+	s.mux.Unlock()
+
+	to := from + block.Index(s.batchSize()) - 1
+	if to > remote {
+		to = remote
+	}
+	return s.RequestRange(info.Hash, from, to)
+}
+
+func (s *Syncer) batchSize() int {
+	if s.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return s.BatchSize
+}
+
+// chain returns a followed chain.
+func (s *Syncer) chain(hash block.ChainHash) *block.Chain {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.init()
+	return s.chains[hash]
+}
+
+func (s *Syncer) init() {
+	if s.chains == nil {
+		s.chains = make(map[block.ChainHash]*block.Chain)
+	}
+	if s.fetches == nil {
+		s.fetches = make(map[block.Hash][]chan *block.Block)
+	}
+	if s.remote == nil {
+		s.remote = make(map[block.ChainHash]block.Index)
+	}
+	if s.requested == nil {
+		s.requested = make(map[block.ChainHash]*request)
+	}
+	if s.seen == nil {
+		maxSeen := s.MaxSeen
+		if maxSeen <= 0 {
+			maxSeen = DefaultMaxSeen
+		}
+		s.seen = &common.LRU{MaxEntries: maxSeen}
+	}
+}
+
+func (s *Syncer) retryInterval() time.Duration {
+	if s.RetryInterval <= 0 {
+		return DefaultRetryInterval
+	}
+	return s.RetryInterval
+}
+
+// send assigns the message an ID and sends it to peers.
+func (s *Syncer) send(msg *Message) error {
+	rb, err := common.NewRandomBytes(16)
+	if err != nil {
+		return err
+	}
+	msg.ID = hex.EncodeToString(rb)
+
+	s.mux.Lock()
+	s.init()
+	s.seen.Add(msg.ID, true, 0)
+	s.mux.Unlock()
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.Sender.Send(data)
+}
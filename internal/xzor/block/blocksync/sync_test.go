@@ -0,0 +1,259 @@
+package blocksync_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/block/blocksync"
+	"github.com/xzor-dev/xzor/internal/xzor/block/memory"
+	"github.com/xzor-dev/xzor/internal/xzor/network"
+)
+
+func TestSync(t *testing.T) {
+	sA := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := sA.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i := 0; i < 24; i++ {
+		_, err := sA.NewBlock(c, []byte("data"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	sB := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+
+	linkA := &testLink{}
+	linkB := &testLink{}
+	syncA := &blocksync.Syncer{
+		BatchSize:     10,
+		RetryInterval: time.Nanosecond,
+		Sender:        linkA,
+		Service:       sA,
+	}
+	syncB := &blocksync.Syncer{
+		BatchSize:     10,
+		RetryInterval: time.Nanosecond,
+		Sender:        linkB,
+		Service:       sB,
+	}
+	linkA.peer = syncB
+	linkB.peer = syncA
+
+	_, err = syncA.Follow(c.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	cB, err := syncB.Follow(c.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Disconnect the peers after the first batch of blocks has been requested.
+	linkA.remaining = 2
+	linkB.remaining = 2
+	err = syncA.Advertise()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(cB.Blocks) != 10 {
+		t.Fatalf("expected the first batch to be synced before disconnecting: wanted 10 blocks, got %d", len(cB.Blocks))
+	}
+
+	linkA.remaining = -1
+	linkB.remaining = -1
+	err = syncA.Advertise()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if cB.LastHash != c.LastHash || len(cB.Blocks) != len(c.Blocks) {
+		t.Fatalf("expected chain to be synced: wanted %d blocks, got %d", len(c.Blocks), len(cB.Blocks))
+	}
+	_, err = sB.ReadBlock(c.LastHash)
+	if err != nil {
+		t.Fatalf("expected synced blocks to be committed: %v", err)
+	}
+	stored, err := sB.ReadChain(c.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if stored.LastHash != c.LastHash {
+		t.Fatal("expected synced chain to be committed")
+	}
+
+	b, err := syncA.FetchBlock(c.LastHash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if b.Hash != c.LastHash {
+		t.Fatalf("unexpected block fetched: wanted %s, got %s", c.LastHash, b.Hash)
+	}
+}
+
+func TestSyncNodes(t *testing.T) {
+	sA := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+	c, err := sA.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i := 0; i < 24; i++ {
+		_, err := sA.NewBlock(c, []byte("data"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	sB := &block.Service{
+		BlockStore: &memory.BlockStore{},
+		ChainStore: &memory.ChainStore{},
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer l.Close()
+
+	nodeA := &network.Node{}
+	nodeB := &network.Node{}
+	syncA := &blocksync.Syncer{
+		BatchSize: 10,
+		Sender:    nodeA,
+		Service:   sA,
+	}
+	syncB := &blocksync.Syncer{
+		BatchSize: 10,
+		Sender:    nodeB,
+		Service:   sB,
+	}
+	nodeA.DataHandler = syncA
+	nodeB.DataHandler = syncB
+	// Node A only accepts the connection, so its messages reach node B over an inbound connection.
+	nodeA.AddListener(&testListener{
+		listener: l,
+	})
+	nodeB.AddConnection(&network.TCPConnection{
+		Address: l.Addr().String(),
+	})
+
+	_, err = syncA.Follow(c.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	cB, err := syncB.Follow(c.Hash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, n := range []*network.Node{nodeA, nodeB} {
+		err := n.Start()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		go func(n *network.Node) {
+			for err := range n.Errors {
+				t.Errorf("%v", err)
+			}
+		}(n)
+	}
+
+	// Keep advertising until node B has connected and synced the chain.
+	deadline := time.Now().Add(5 * time.Second)
+	for cB.Info().Head != c.LastHash {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out syncing chain: wanted %d blocks, got %d", c.Info().Height+1, cB.Info().Height+1)
+		}
+		err = syncA.Advertise()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = sB.ReadBlock(c.LastHash)
+	if err != nil {
+		t.Fatalf("expected synced blocks to be committed: %v", err)
+	}
+}
+
+func TestFollowPolicy(t *testing.T) {
+	s := &block.Service{
+		BlockStore:      &memory.BlockStore{},
+		ChainStore:      &memory.ChainStore{},
+		SignaturePolicy: block.RequireSigned,
+	}
+	syncer := &blocksync.Syncer{
+		Sender:  &testLink{},
+		Service: s,
+	}
+	c, err := syncer.Follow("chain")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if c.SignaturePolicy != block.RequireSigned {
+		t.Fatal("expected followed chain to use the service's signature policy")
+	}
+
+	s.ChainStore = &failingChainStore{}
+	_, err = syncer.Follow("other")
+	if err != errChainStore {
+		t.Fatalf("expected chain store error, got %v", err)
+	}
+}
+
+var errChainStore = errors.New("chain store failed")
+
+// failingChainStore fails every read.
+type failingChainStore struct {
+	memory.ChainStore
+}
+
+func (s *failingChainStore) Read(block.ChainHash) (*block.Chain, error) {
+	return nil, errChainStore
+}
+
+var _ blocksync.Sender = &testLink{}
+
+// testLink delivers messages directly to a peer until its remaining message count runs out.
+type testLink struct {
+	peer      *blocksync.Syncer
+	remaining int
+}
+
+func (l *testLink) Send(data []byte) error {
+	if l.remaining == 0 {
+		return nil
+	}
+	if l.remaining > 0 {
+		l.remaining--
+	}
+	return ignoreNoRelay(l.peer.HandleData(data))
+}
+
+func ignoreNoRelay(err error) error {
+	if err == network.ErrNoRelay {
+		return nil
+	}
+	return err
+}
+
+var _ network.Listener = &testListener{}
+
+// testListener starts listening with an already opened net.Listener.
+type testListener struct {
+	listener net.Listener
+}
+
+func (l *testListener) Listen() (net.Listener, error) {
+	return l.listener, nil
+}
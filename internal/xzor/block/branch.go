@@ -5,10 +5,13 @@ import (
 )
 
 // Branch holds information on branched chains.
+// MergeBlock is set to the hash of the block that merged the branch back into its parent chain.
 type Branch struct {
-	FromBlock Hash
-	Hash      BranchHash
-	ToChain   ChainHash
+	FromBlock  Hash
+	FromChain  ChainHash
+	Hash       BranchHash
+	MergeBlock Hash
+	ToChain    ChainHash
 }
 
 // BranchHash is a unique string assigned to branches.
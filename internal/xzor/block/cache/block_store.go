@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+)
+
+var _ block.Store = &BlockStore{}
+var _ block.HashLister = &BlockStore{}
+
+// BlockStore is a read-through cache in front of another block store.
+// Blocks read from Store are kept in Cache, sized by the length of their data,
+// and writes go through to Store before updating the cache. A nil Cache disables caching.
+// Blocks are copied into and out of the cache, so changes made by callers never reach it.
+type BlockStore struct {
+	Cache *common.LRU
+	Store block.Store
+
+	mux sync.RWMutex
+}
+
+// Delete removes a block from Store and the cache.
+func (s *BlockStore) Delete(hash block.Hash) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.Cache.Remove(string(hash))
+	return s.Store.Delete(hash)
+}
+
+// Hashes returns the hashes of the blocks in Store, which must implement block.HashLister.
+func (s *BlockStore) Hashes() ([]block.Hash, error) {
+	lister, ok := s.Store.(block.HashLister)
+	if !ok {
+		return nil, errors.New("the cached block store cannot list its blocks")
+	}
+	return lister.Hashes()
+}
+
+// Read returns a block from the cache, reading it from Store when it is not cached.
+func (s *BlockStore) Read(hash block.Hash) (*block.Block, error) {
+	if cached, ok := s.Cache.Get(string(hash)); ok {
+		return cached.(*block.Block).Copy(), nil
+	}
+
+	// Reads hold the lock while filling the cache so a block deleted
+	// after being read is not added back to the cache.
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	b, err := s.Store.Read(hash)
+	if err != nil {
+		return nil, err
+	}
+	s.Cache.Add(string(hash), b.Copy(), len(b.Data))
+	return b, nil
+}
+
+// Stats returns the cache's hit, miss and eviction counts.
+func (s *BlockStore) Stats() common.CacheStats {
+	return s.Cache.Stats()
+}
+
+// Write writes a block to Store and caches it.
+func (s *BlockStore) Write(b *block.Block) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.Cache.Remove(string(b.Hash))
+	err := s.Store.Write(b)
+	if err != nil {
+		return err
+	}
+	s.Cache.Add(string(b.Hash), b.Copy(), len(b.Data))
+	return nil
+}
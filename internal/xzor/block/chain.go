@@ -1,6 +1,7 @@
 package block
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -8,11 +9,25 @@ import (
 )
 
 // Chain holds a set of blocks and enforces their ordering.
+// Block timestamps must not decrease along the chain, nor be more than MaxClockSkew
+// ahead of the chain's clock. The clock and skew are local settings and are not stored.
+// TimestampVersion gives the precision of the chain's timestamps, which chains stored
+// before it was recorded read as SecondTimestamps.
 type Chain struct {
-	Blocks   map[Hash]Index
-	Branches map[BranchHash]*Branch
-	Hash     ChainHash
-	LastHash Hash
+	Blocks           map[Hash]Index
+	Branches         map[BranchHash]*Branch
+	Clock            Clock `json:"-"`
+	Created          int64
+	Description      string
+	Hash             ChainHash
+	LastHash         Hash
+	LastTimestamp    int64
+	MaxClockSkew     time.Duration `json:"-"`
+	Origin           *Branch
+	Owner            string
+	PrunedIndex      Index
+	SignaturePolicy  SignaturePolicy
+	TimestampVersion TimestampVersion
 
 	mux sync.Mutex
 }
@@ -22,34 +37,82 @@ func (c *Chain) AddBlock(b *Block) error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
+	return c.addBlock(b)
+}
+
+// addBlock adds a new block to the chain without locking it.
+func (c *Chain) addBlock(b *Block) error {
+	if b.Hash == "" {
+		hash, err := NewHash(b)
+		if err != nil {
+			return err
+		}
+		b.Hash = hash
+	}
+
+	err := b.verifyMerkleRoot()
+	if err != nil {
+		return err
+	}
+
+	h, err := b.Header()
+	if err != nil {
+		return err
+	}
+	return c.addHeader(h)
+}
+
+// AddHeader adds a block to the chain using only its header.
+func (c *Chain) AddHeader(h *Header) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.addHeader(h)
+}
+
+// addHeader verifies a block's header and adds the block to the chain without locking it.
+func (c *Chain) addHeader(h *Header) error {
 	if c.Blocks == nil {
 		c.Blocks = make(map[Hash]Index)
 	}
 
-	hash, err := NewHash(b)
+	hash, err := h.hash()
 	if err != nil {
 		return err
 	}
-
-	if b.Hash == "" {
-		b.Hash = hash
-	} else if hash != b.Hash {
+	if hash != h.Hash {
 		return ErrInvalidHash
 	}
 
+	if h.Signed() {
+		err = h.verifySignature()
+		if err != nil {
+			return err
+		}
+	} else if c.SignaturePolicy == RequireSigned {
+		return ErrUnsignedBlock
+	}
+
 	if c.LastHash != "" {
 		lastIndex := c.Blocks[c.LastHash]
 
-		if b.PreviousHash != c.LastHash {
+		if h.PreviousHash != c.LastHash {
 			return ErrInvalidPrevHash
 		}
-		if b.Index != lastIndex+1 {
+		if h.Index != lastIndex+1 {
 			return ErrInvalidIndex
 		}
+		if h.Timestamp < c.LastTimestamp {
+			return ErrInvalidTimestamp
+		}
+	}
+	if c.TimestampVersion.time(h.Timestamp).After(c.now().Add(c.maxClockSkew())) {
+		return ErrInvalidTimestamp
 	}
 
-	c.Blocks[b.Hash] = b.Index
-	c.LastHash = b.Hash
+	c.Blocks[h.Hash] = h.Index
+	c.LastHash = h.Hash
+	c.LastTimestamp = h.Timestamp
 
 	return nil
 }
@@ -59,31 +122,189 @@ func (c *Chain) NewBlock(data []byte) *Block {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
+	return c.newBlock(data)
+}
+
+// newBlock creates a new block without locking the chain.
+func (c *Chain) newBlock(data []byte) *Block {
 	index := 0
 	if c.LastHash != "" {
 		lastIndex := c.Blocks[c.LastHash]
 		index = int(lastIndex) + 1
 	}
 
+	// A clock that has moved backwards must not produce a block the chain would reject.
+	timestamp := c.TimestampVersion.timestamp(c.now())
+	if timestamp < c.LastTimestamp {
+		timestamp = c.LastTimestamp
+	}
 	return &Block{
 		Data:         data,
 		Index:        Index(index),
 		PreviousHash: c.LastHash,
-		Timestamp:    time.Now().Unix(),
+		Timestamp:    timestamp,
 	}
 }
 
+// NewBatchBlock creates a new block holding the provided items along with their merkle root.
+func (c *Chain) NewBatchBlock(items [][]byte) (*Block, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.newBatchBlock(items)
+}
+
+// newBatchBlock creates a new batch block without locking the chain.
+func (c *Chain) newBatchBlock(items [][]byte) (*Block, error) {
+	root, err := MerkleRoot(items)
+	if err != nil {
+		return nil, err
+	}
+	b := c.newBlock(EncodeItems(items))
+	b.MerkleRoot = root
+	return b, nil
+}
+
+// Copy returns a deep copy of the chain.
+// The chain is not locked, so callers must hold its lock or otherwise own it exclusively.
+func (c *Chain) Copy() *Chain {
+	cp := &Chain{
+		Created:          c.Created,
+		Description:      c.Description,
+		Hash:             c.Hash,
+		LastHash:         c.LastHash,
+		LastTimestamp:    c.LastTimestamp,
+		Owner:            c.Owner,
+		PrunedIndex:      c.PrunedIndex,
+		SignaturePolicy:  c.SignaturePolicy,
+		TimestampVersion: c.TimestampVersion,
+	}
+	if c.Blocks != nil {
+		cp.Blocks = make(map[Hash]Index, len(c.Blocks))
+		for hash, index := range c.Blocks {
+			cp.Blocks[hash] = index
+		}
+	}
+	if c.Branches != nil {
+		cp.Branches = make(map[BranchHash]*Branch, len(c.Branches))
+		for hash, branch := range c.Branches {
+			b := *branch
+			cp.Branches[hash] = &b
+		}
+	}
+	if c.Origin != nil {
+		origin := *c.Origin
+		cp.Origin = &origin
+	}
+	return cp
+}
+
+// Has checks if the chain contains a block.
+func (c *Chain) Has(hash Hash) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	_, ok := c.Blocks[hash]
+	return ok
+}
+
+// Hashes returns the hashes of the chain's blocks ordered by their index.
+func (c *Chain) Hashes() []Hash {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.hashes()
+}
+
+// Range returns the hashes of the chain's blocks within an inclusive index range, ordered by their index.
+func (c *Chain) Range(from, to Index) []Hash {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	hashes := make([]Hash, 0)
+	for _, h := range c.hashes() {
+		if i := c.Blocks[h]; i >= from && i <= to {
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes
+}
+
+// hashes returns the hashes of the chain's blocks ordered by their index.
+func (c *Chain) hashes() []Hash {
+	hashes := make([]Hash, 0, len(c.Blocks))
+	for hash := range c.Blocks {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return c.Blocks[hashes[i]] < c.Blocks[hashes[j]]
+	})
+	return hashes
+}
+
+// Info describes the chain using its metadata.
+func (c *Chain) Info() *ChainInfo {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return &ChainInfo{
+		Created:     c.Created,
+		Description: c.Description,
+		Hash:        c.Hash,
+		Head:        c.LastHash,
+		Height:      c.Blocks[c.LastHash],
+		Owner:       c.Owner,
+		Parent:      c.Origin,
+	}
+}
+
+// Pruned checks if the block has been pruned from the block store.
+func (c *Chain) Pruned(hash Hash) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	index, ok := c.Blocks[hash]
+	return ok && index < c.PrunedIndex
+}
+
+// removeHead removes the chain's last block, restoring the previous head.
+// It is used to roll back a block that could not be committed to storage.
+func (c *Chain) removeHead(prevHash Hash, prevTimestamp int64) {
+	delete(c.Blocks, c.LastHash)
+	c.LastHash = prevHash
+	c.LastTimestamp = prevTimestamp
+}
+
+// maxClockSkew returns how far into the future a block's timestamp may be.
+func (c *Chain) maxClockSkew() time.Duration {
+	if c.MaxClockSkew > 0 {
+		return c.MaxClockSkew
+	}
+	return DefaultMaxClockSkew
+}
+
+// now returns the current time from the chain's clock.
+func (c *Chain) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
 // NewBranch creates a new branch off of the provided block to the provided chain.
 func (c *Chain) NewBranch(fromBlock *Block, toChain *Chain) (*Branch, error) {
-	if c.Branches == nil {
-		c.Branches = make(map[BranchHash]*Branch)
-	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
 	if c.Blocks == nil {
 		return nil, ErrEmptyChain
 	}
-	if c.Blocks[fromBlock.Hash] == 0 {
+	if _, ok := c.Blocks[fromBlock.Hash]; !ok {
 		return nil, ErrInvalidHash
 	}
+	if c.Branches == nil {
+		c.Branches = make(map[BranchHash]*Branch)
+	}
 
 	hash, err := NewBranchHash()
 	if err != nil {
@@ -91,6 +312,7 @@ func (c *Chain) NewBranch(fromBlock *Block, toChain *Chain) (*Branch, error) {
 	}
 	branch := &Branch{
 		FromBlock: fromBlock.Hash,
+		FromChain: c.Hash,
 		Hash:      hash,
 		ToChain:   toChain.Hash,
 	}
@@ -119,9 +341,47 @@ func NewChainHash() (ChainHash, error) {
 	return ch, nil
 }
 
+// ChainInfo describes a chain without its blocks.
+// Height is the index of the chain's head and Parent is the branch the chain was created from.
+type ChainInfo struct {
+	Created     int64
+	Description string
+	Hash        ChainHash
+	Head        Hash
+	Height      Index
+	Owner       string
+	Parent      *Branch
+}
+
+// ChainQuery matches chains by their metadata. Empty fields match every chain.
+type ChainQuery struct {
+	Description string
+	Owner       string
+	Parent      ChainHash
+}
+
+// Match checks if the chain described by info matches the query.
+func (q *ChainQuery) Match(info *ChainInfo) bool {
+	if q.Description != "" && q.Description != info.Description {
+		return false
+	}
+	if q.Owner != "" && q.Owner != info.Owner {
+		return false
+	}
+	if q.Parent != "" && (info.Parent == nil || info.Parent.FromChain != q.Parent) {
+		return false
+	}
+	return true
+}
+
 // ChainStore handles storage operations for chains.
+// List returns chains ordered by hash, starting after the provided hash and returning
+// at most limit chains, or every remaining chain when limit is zero.
+// Read returns ErrChainNotFound for chains that do not exist.
 type ChainStore interface {
 	Delete(ChainHash) error
+	Find(*ChainQuery) ([]*ChainInfo, error)
+	List(after ChainHash, limit int) ([]*ChainInfo, error)
 	Read(ChainHash) (*Chain, error)
 	Write(*Chain) error
 }
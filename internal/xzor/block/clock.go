@@ -0,0 +1,60 @@
+package block
+
+import "time"
+
+// DefaultMaxClockSkew is how far into the future a block's timestamp may be
+// when a chain does not set its own limit.
+const DefaultMaxClockSkew = time.Minute
+
+// Clock provides the current time to chains and services, allowing tests to control time.
+type Clock interface {
+	Now() time.Time
+}
+
+var _ Clock = SystemClock{}
+
+// SystemClock reads the local system time.
+type SystemClock struct{}
+
+// Now returns the current local time.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// TimestampVersion identifies the precision of the block timestamps of a chain.
+type TimestampVersion int
+
+const (
+	// SecondTimestamps is used by chains created before timestamps had millisecond precision.
+	// Their blocks keep timestamps in seconds, since a block's timestamp is part of its hash.
+	SecondTimestamps TimestampVersion = iota
+
+	// MillisecondTimestamps is used by every chain created since.
+	MillisecondTimestamps
+)
+
+// Timestamp converts a time into a timestamp with millisecond precision, as used by blocks.
+func Timestamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// TimestampTime converts a millisecond timestamp back into a time.
+func TimestampTime(timestamp int64) time.Time {
+	return time.Unix(0, timestamp*int64(time.Millisecond))
+}
+
+// timestamp converts a time into a timestamp of the version's precision.
+func (v TimestampVersion) timestamp(t time.Time) int64 {
+	if v == SecondTimestamps {
+		return t.Unix()
+	}
+	return Timestamp(t)
+}
+
+// time converts a timestamp of the version's precision back into a time.
+func (v TimestampVersion) time(timestamp int64) time.Time {
+	if v == SecondTimestamps {
+		return time.Unix(timestamp, 0)
+	}
+	return TimestampTime(timestamp)
+}
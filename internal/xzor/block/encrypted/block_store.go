@@ -0,0 +1,128 @@
+package encrypted
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/encryption"
+)
+
+var _ block.Store = &BlockStore{}
+var _ block.HashLister = &BlockStore{}
+var _ encryption.Reencrypter = &BlockStore{}
+
+// BlockStore encrypts the data of blocks before they reach another block store.
+// Headers are left readable so chains can still be followed, while each block's data is
+// sealed with the keyring's active key, authenticated along with the block's hash.
+// A Journal committing blocks must be given this store rather than Store to encrypt them.
+// Stores holding blocks written before encryption was enabled can set AllowPlaintext
+// to read them until they are sealed by Reencrypt.
+type BlockStore struct {
+	AllowPlaintext bool
+	Keyring        encryption.Keyring
+	Store          block.Store
+
+	mux sync.Mutex
+}
+
+// Delete removes a block from Store.
+func (s *BlockStore) Delete(hash block.Hash) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.Store.Delete(hash)
+}
+
+// Hashes returns the hashes of the blocks in Store, which must implement block.HashLister.
+func (s *BlockStore) Hashes() ([]block.Hash, error) {
+	lister, ok := s.Store.(block.HashLister)
+	if !ok {
+		return nil, errors.New("the encrypted block store cannot list its blocks")
+	}
+	return lister.Hashes()
+}
+
+// Read gets a block from Store and opens its data.
+func (s *BlockStore) Read(hash block.Hash) (*block.Block, error) {
+	b, err := s.Store.Read(hash)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(b)
+}
+
+// Reencrypt seals the data of every block that was not sealed with the keyring's active key,
+// including plaintext blocks, returning the number resealed. Store must implement block.HashLister.
+func (s *BlockStore) Reencrypt() (int, error) {
+	hashes, err := s.Hashes()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, hash := range hashes {
+		resealed, err := s.reencrypt(hash)
+		if err != nil {
+			return count, err
+		}
+		if resealed {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Write seals a block's data and writes the block to Store.
+func (s *BlockStore) Write(b *block.Block) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.write(b)
+}
+
+// reencrypt reseals a block's data with the active key while holding off writes.
+func (s *BlockStore) reencrypt(hash block.Hash) (bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	active, _, err := s.Keyring.ActiveKey()
+	if err != nil {
+		return false, err
+	}
+	b, err := s.Store.Read(hash)
+	if err != nil {
+		return false, err
+	}
+	if keyID, err := encryption.SealedKeyID(b.Data); err == nil && keyID == active {
+		return false, nil
+	}
+	b, err = s.open(b)
+	if err != nil {
+		return false, err
+	}
+	return true, s.write(b)
+}
+
+// open returns the block with its data opened, passing plaintext through when it is allowed.
+func (s *BlockStore) open(b *block.Block) (*block.Block, error) {
+	if s.AllowPlaintext && !encryption.IsSealed(b.Data) {
+		return b, nil
+	}
+	data, err := encryption.Open(s.Keyring, b.Data, []byte(b.Hash))
+	if err != nil {
+		return nil, err
+	}
+	opened := *b
+	opened.Data = data
+	return &opened, nil
+}
+
+func (s *BlockStore) write(b *block.Block) error {
+	data, err := encryption.Seal(s.Keyring, b.Data, []byte(b.Hash))
+	if err != nil {
+		return err
+	}
+	sealed := *b
+	sealed.Data = data
+	return s.Store.Write(&sealed)
+}
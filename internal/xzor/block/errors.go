@@ -13,3 +13,55 @@ var ErrInvalidIndex = errors.New("invalid block index")
 
 // ErrInvalidPrevHash occurs when a block's previous hash does not match the chain's last block hash.
 var ErrInvalidPrevHash = errors.New("invalid previous block hash")
+
+// ErrInvalidSignature occurs when a block's signature does not match its author and header.
+var ErrInvalidSignature = errors.New("invalid block signature")
+
+// ErrUnsignedBlock occurs when an unsigned block is added to a chain that requires signatures.
+var ErrUnsignedBlock = errors.New("unsigned block")
+
+// ErrEmptyBatch occurs when a batch of block items is empty.
+var ErrEmptyBatch = errors.New("empty batch")
+
+// ErrInvalidMerkleRoot occurs when a block's merkle root does not match its data.
+var ErrInvalidMerkleRoot = errors.New("invalid merkle root")
+
+// ErrInvalidProof occurs when a merkle proof does not match the merkle root.
+var ErrInvalidProof = errors.New("invalid merkle proof")
+
+// ErrBranchMerged occurs when merging a branch that has already been merged.
+var ErrBranchMerged = errors.New("branch already merged")
+
+// ErrInvalidBranch occurs when a branch cannot be found on a chain.
+var ErrInvalidBranch = errors.New("invalid branch")
+
+// ErrArchivalMode occurs when attempting to prune a chain on an archival node.
+var ErrArchivalMode = errors.New("chains cannot be pruned in archival mode")
+
+// ErrInvalidArchive occurs when an archive is malformed or fails its checksums.
+var ErrInvalidArchive = errors.New("invalid chain archive")
+
+// ErrInvalidBody occurs when a fetched block does not match its stored header.
+var ErrInvalidBody = errors.New("block does not match its header")
+
+// ErrUntypedPayload occurs when a block's data is not wrapped in a payload envelope.
+var ErrUntypedPayload = errors.New("untyped block payload")
+
+// ErrUnknownPayload occurs when no decoder is registered for a payload's type.
+var ErrUnknownPayload = errors.New("unknown payload type")
+
+// ErrPayloadRegistered occurs when registering a decoder for a payload type that already has one.
+var ErrPayloadRegistered = errors.New("payload type already registered")
+
+// ErrHeadMismatch occurs when a compare-and-append finds the chain's head has moved.
+var ErrHeadMismatch = errors.New("chain head does not match the expected head")
+
+// ErrInvalidTimestamp occurs when a block's timestamp is earlier than its chain's last block
+// or too far ahead of the local clock.
+var ErrInvalidTimestamp = errors.New("invalid block timestamp")
+
+// ErrChainNotFound occurs when reading a chain that does not exist.
+var ErrChainNotFound = errors.New("chain not found")
+
+// ErrChainExists occurs when importing a chain that already exists.
+var ErrChainExists = errors.New("chain already exists")
@@ -0,0 +1,231 @@
+package block
+
+import (
+	"errors"
+	"sync"
+)
+
+// EventType identifies the kind of change described by an event.
+type EventType int
+
+const (
+	// BlockAppended events are published when a block is committed to a chain.
+	BlockAppended EventType = iota + 1
+
+	// BranchCreated events are published when a branch is created from a chain.
+	BranchCreated
+
+	// Reorg events are published when a chain's head is moved back to an earlier block.
+	Reorg
+)
+
+// Event describes a change to a chain.
+// Block is set for BlockAppended events, Branch for BranchCreated events,
+// and PreviousHead for Reorg events. Head is the chain's head after the change.
+type Event struct {
+	Block        *Block
+	Branch       *Branch
+	Chain        ChainHash
+	Head         Hash
+	PreviousHead Hash
+	Type         EventType
+}
+
+// Subscription delivers the events of a single chain in the order they occurred.
+type Subscription struct {
+	chain  ChainHash
+	cond   *sync.Cond
+	closed bool
+	done   chan struct{}
+	events chan *Event
+	hub    *eventHub
+	mux    sync.Mutex
+	queue  []*Event
+}
+
+// Close stops the subscription and closes its event channel.
+func (sub *Subscription) Close() {
+	sub.hub.remove(sub)
+
+	sub.mux.Lock()
+	if !sub.closed {
+		sub.closed = true
+		close(sub.done)
+	}
+	sub.mux.Unlock()
+	sub.cond.Broadcast()
+}
+
+// Events returns the channel the subscription's events are delivered on.
+func (sub *Subscription) Events() <-chan *Event {
+	return sub.events
+}
+
+// deliver sends queued events to the event channel until the subscription is closed.
+func (sub *Subscription) deliver() {
+	defer close(sub.events)
+	for {
+		sub.mux.Lock()
+		for len(sub.queue) == 0 && !sub.closed {
+			sub.cond.Wait()
+		}
+		if sub.closed {
+			sub.mux.Unlock()
+			return
+		}
+		e := sub.queue[0]
+		sub.queue = sub.queue[1:]
+		sub.mux.Unlock()
+
+		select {
+		case sub.events <- e:
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+// push queues an event for delivery without blocking.
+func (sub *Subscription) push(e *Event) {
+	sub.mux.Lock()
+	sub.queue = append(sub.queue, e)
+	sub.mux.Unlock()
+	sub.cond.Signal()
+}
+
+// eventHub tracks the subscriptions of each chain.
+type eventHub struct {
+	mux  sync.Mutex
+	subs map[ChainHash][]*Subscription
+}
+
+func (h *eventHub) add(sub *Subscription) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.subs == nil {
+		h.subs = make(map[ChainHash][]*Subscription)
+	}
+	h.subs[sub.chain] = append(h.subs[sub.chain], sub)
+}
+
+// publish queues an event on every subscription of its chain.
+func (h *eventHub) publish(e *Event) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	for _, sub := range h.subs[e.Chain] {
+		sub.push(e)
+	}
+}
+
+func (h *eventHub) remove(sub *Subscription) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	subs := h.subs[sub.chain]
+	for i, s := range subs {
+		if s == sub {
+			h.subs[sub.chain] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(h.subs[sub.chain]) == 0 {
+		delete(h.subs, sub.chain)
+	}
+}
+
+// Rewind moves the chain's head back to an earlier block, removing every later block from the chain
+// and publishing a Reorg event. The removed blocks are left in the block store.
+// Branches merged by a removed block are marked as unmerged, so they can be merged again.
+func (s *Service) Rewind(c *Chain, to Hash) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	index, ok := c.Blocks[to]
+	if !ok {
+		return ErrInvalidHash
+	}
+	for _, branch := range c.Branches {
+		if c.Blocks[branch.FromBlock] > index {
+			return errors.New("cannot rewind a chain past one of its branches")
+		}
+	}
+
+	unmerged := make(map[*Branch]Hash)
+	for _, branch := range c.Branches {
+		if i, ok := c.Blocks[branch.MergeBlock]; ok && i > index {
+			unmerged[branch] = branch.MergeBlock
+			branch.MergeBlock = ""
+		}
+	}
+	removed := make(map[Hash]Index)
+	for h, i := range c.Blocks {
+		if i > index {
+			removed[h] = i
+			delete(c.Blocks, h)
+		}
+	}
+	// The chain's last timestamp is kept, so blocks appended after the rewind
+	// still cannot be dated before any block the chain has already seen.
+	head := c.LastHash
+	c.LastHash = to
+	err := s.WriteChain(c)
+	if err != nil {
+		for h, i := range removed {
+			c.Blocks[h] = i
+		}
+		for branch, merge := range unmerged {
+			branch.MergeBlock = merge
+		}
+		c.LastHash = head
+		return err
+	}
+
+	s.events.publish(&Event{
+		Chain:        c.Hash,
+		Head:         to,
+		PreviousHead: head,
+		Type:         Reorg,
+	})
+	return nil
+}
+
+// Subscribe creates a subscription to a chain's events.
+// The chain's blocks starting at the provided index are replayed as BlockAppended events
+// before any new events are delivered.
+func (s *Service) Subscribe(c *Chain, from Index) (*Subscription, error) {
+	sub := &Subscription{
+		chain:  c.Hash,
+		done:   make(chan struct{}),
+		events: make(chan *Event),
+		hub:    &s.events,
+		queue:  make([]*Event, 0),
+	}
+	sub.cond = sync.NewCond(&sub.mux)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, h := range c.hashes() {
+		if c.Blocks[h] < from {
+			continue
+		}
+		if s.BlockStore == nil {
+			return nil, errors.New("no BlockStore provided to the storage service")
+		}
+		b, err := s.BlockStore.Read(h)
+		if err != nil {
+			return nil, err
+		}
+		sub.queue = append(sub.queue, &Event{
+			Block: b,
+			Chain: c.Hash,
+			Head:  b.Hash,
+			Type:  BlockAppended,
+		})
+	}
+	s.events.add(sub)
+	go sub.deliver()
+	return sub, nil
+}
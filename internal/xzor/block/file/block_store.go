@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
 )
 
 var _ block.Store = &BlockStore{}
+var _ block.HashLister = &BlockStore{}
 
 // BlockStore provides reading and writing of blocks to the file system.
 type BlockStore struct {
@@ -24,6 +27,24 @@ func (s *BlockStore) Delete(hash block.Hash) error {
 	return os.Remove(s.filename(hash))
 }
 
+// Hashes returns the hashes of every block on the file system.
+func (s *BlockStore) Hashes() ([]block.Hash, error) {
+	files, err := ioutil.ReadDir(s.RootDir)
+	if os.IsNotExist(err) {
+		return []block.Hash{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	hashes := make([]block.Hash, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || strings.Contains(f.Name(), ".") {
+			continue
+		}
+		hashes = append(hashes, block.Hash(f.Name()))
+	}
+	return hashes, nil
+}
+
 // Read gets a block using its hash.
 func (s *BlockStore) Read(hash block.Hash) (*block.Block, error) {
 	filename := s.filename(hash)
@@ -39,28 +60,17 @@ func (s *BlockStore) Read(hash block.Hash) (*block.Block, error) {
 	return b, nil
 }
 
-// Write a block to the file system.
-func (s *BlockStore) Write(b *block.Block) error {
-	err := os.MkdirAll(s.RootDir, 0666)
-	if err != nil {
-		return err
-	}
-
-	filename := s.filename(b.Hash)
-	f, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+// Recover removes temporary files left by writes that were interrupted by a crash.
+// It should be called before the store is used after a crash.
+func (s *BlockStore) Recover() error {
+	return common.RemoveTempFiles(s.RootDir)
+}
 
+// Write a block to the file system, atomically replacing any previous version.
+func (s *BlockStore) Write(b *block.Block) error {
 	data, err := json.Marshal(b)
 	if err != nil {
 		return err
 	}
-
-	_, err = f.Write(data)
-	if err != nil {
-		return err
-	}
-	return nil
+	return common.WriteFile(s.filename(b.Hash), data, 0644)
 }
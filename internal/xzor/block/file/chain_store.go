@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
 )
 
 var _ block.ChainStore = &ChainStore{}
@@ -24,11 +26,54 @@ func (s *ChainStore) Delete(hash block.ChainHash) error {
 	return os.Remove(s.filename(hash))
 }
 
+// Find returns the chains on the file system matching the query.
+func (s *ChainStore) Find(q *block.ChainQuery) ([]*block.ChainInfo, error) {
+	chains, err := s.List("", 0)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]*block.ChainInfo, 0)
+	for _, info := range chains {
+		if q.Match(info) {
+			found = append(found, info)
+		}
+	}
+	return found, nil
+}
+
+// List returns chains on the file system ordered by hash, starting after the provided hash.
+func (s *ChainStore) List(after block.ChainHash, limit int) ([]*block.ChainInfo, error) {
+	files, err := ioutil.ReadDir(s.RootDir)
+	if os.IsNotExist(err) {
+		return []*block.ChainInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	chains := make([]*block.ChainInfo, 0)
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || strings.Contains(name, ".") || name <= string(after) {
+			continue
+		}
+		if limit > 0 && len(chains) == limit {
+			break
+		}
+		c, err := s.Read(block.ChainHash(name))
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, c.Info())
+	}
+	return chains, nil
+}
+
 // Read chain's data using its hash.
 func (s *ChainStore) Read(hash block.ChainHash) (*block.Chain, error) {
 	filename := s.filename(hash)
 	data, err := ioutil.ReadFile(filename)
-	if err != nil {
+	if os.IsNotExist(err) {
+		return nil, block.ErrChainNotFound
+	} else if err != nil {
 		return nil, err
 	}
 	c := &block.Chain{}
@@ -39,28 +84,16 @@ func (s *ChainStore) Read(hash block.ChainHash) (*block.Chain, error) {
 	return c, nil
 }
 
-// Write a chain to the file system.
-func (s *ChainStore) Write(c *block.Chain) error {
-	err := os.MkdirAll(s.RootDir, 0666)
-	if err != nil {
-		return err
-	}
-
-	filename := s.filename(c.Hash)
-	f, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+// Recover removes temporary files left by writes that were interrupted by a crash.
+func (s *ChainStore) Recover() error {
+	return common.RemoveTempFiles(s.RootDir)
+}
 
+// Write a chain to the file system, atomically replacing any previous version.
+func (s *ChainStore) Write(c *block.Chain) error {
 	data, err := json.Marshal(c)
 	if err != nil {
 		return err
 	}
-
-	_, err = f.Write(data)
-	if err != nil {
-		return err
-	}
-	return nil
+	return common.WriteFile(s.filename(c.Hash), data, 0644)
 }
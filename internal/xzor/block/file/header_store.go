@@ -0,0 +1,54 @@
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+)
+
+var _ block.HeaderStore = &HeaderStore{}
+
+// HeaderStore provides reading and writing of block headers to the file system.
+type HeaderStore struct {
+	RootDir string
+}
+
+func (s *HeaderStore) filename(hash block.Hash) string {
+	return s.RootDir + "/" + string(hash)
+}
+
+// Delete removes the header's data file.
+func (s *HeaderStore) Delete(hash block.Hash) error {
+	return os.Remove(s.filename(hash))
+}
+
+// Read gets a header using its block's hash.
+func (s *HeaderStore) Read(hash block.Hash) (*block.Header, error) {
+	data, err := ioutil.ReadFile(s.filename(hash))
+	if err != nil {
+		return nil, err
+	}
+	h := &block.Header{}
+	err = json.Unmarshal(data, h)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Recover removes temporary files left by writes that were interrupted by a crash.
+func (s *HeaderStore) Recover() error {
+	return common.RemoveTempFiles(s.RootDir)
+}
+
+// Write a header to the file system, atomically replacing any previous version.
+func (s *HeaderStore) Write(h *block.Header) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return common.WriteFile(s.filename(h.Hash), data, 0644)
+}
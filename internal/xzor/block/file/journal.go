@@ -0,0 +1,101 @@
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+)
+
+const journalExt = ".journal"
+
+var _ block.Committer = &Journal{}
+
+// Journal commits blocks and chains to the file stores using a write-ahead journal.
+// Each commit is recorded in the journal before the stores are written,
+// allowing Recover to finish commits that were interrupted by a crash.
+type Journal struct {
+	BlockStore *BlockStore
+	ChainStore *ChainStore
+	RootDir    string
+}
+
+type journalEntry struct {
+	Block *block.Block
+	Chain *block.Chain
+}
+
+func (j *Journal) filename(c *block.Chain) string {
+	return j.RootDir + "/" + string(c.Hash) + journalExt
+}
+
+// Commit records the block and chain in the journal, writes them to their stores
+// and removes the journal entry once both writes have succeeded.
+func (j *Journal) Commit(b *block.Block, c *block.Chain) error {
+	data, err := json.Marshal(&journalEntry{
+		Block: b,
+		Chain: c,
+	})
+	if err != nil {
+		return err
+	}
+	filename := j.filename(c)
+	err = common.WriteFile(filename, data, 0644)
+	if err != nil {
+		return err
+	}
+	err = j.apply(b, c)
+	if err != nil {
+		os.Remove(filename)
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// Recover completes any commits left in the journal.
+func (j *Journal) Recover() error {
+	files, err := ioutil.ReadDir(j.RootDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, f := range files {
+		filename := j.RootDir + "/" + f.Name()
+		if !strings.HasSuffix(f.Name(), journalExt) {
+			if strings.HasSuffix(f.Name(), common.TempFileExt) {
+				os.Remove(filename)
+			}
+			continue
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		entry := &journalEntry{}
+		err = json.Unmarshal(data, entry)
+		if err != nil {
+			return err
+		}
+		err = j.apply(entry.Block, entry.Chain)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(filename)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *Journal) apply(b *block.Block, c *block.Chain) error {
+	err := j.BlockStore.Write(b)
+	if err != nil {
+		return err
+	}
+	return j.ChainStore.Write(c)
+}
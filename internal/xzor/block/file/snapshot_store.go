@@ -0,0 +1,54 @@
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+)
+
+var _ block.SnapshotStore = &SnapshotStore{}
+
+// SnapshotStore provides reading and writing of snapshots to the file system.
+type SnapshotStore struct {
+	RootDir string
+}
+
+func (s *SnapshotStore) filename(hash block.ChainHash) string {
+	return s.RootDir + "/" + string(hash)
+}
+
+// Delete removes the chain's snapshot file.
+func (s *SnapshotStore) Delete(hash block.ChainHash) error {
+	return os.Remove(s.filename(hash))
+}
+
+// Read a chain's snapshot using the chain's hash.
+func (s *SnapshotStore) Read(hash block.ChainHash) (*block.Snapshot, error) {
+	data, err := ioutil.ReadFile(s.filename(hash))
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &block.Snapshot{}
+	err = json.Unmarshal(data, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Recover removes temporary files left by writes that were interrupted by a crash.
+func (s *SnapshotStore) Recover() error {
+	return common.RemoveTempFiles(s.RootDir)
+}
+
+// Write a snapshot to the file system, atomically replacing the chain's previous snapshot.
+func (s *SnapshotStore) Write(snapshot *block.Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return common.WriteFile(s.filename(snapshot.Chain), data, 0644)
+}
@@ -0,0 +1,223 @@
+package block
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// HashLister is implemented by block stores that can enumerate the blocks they hold.
+type HashLister interface {
+	Hashes() ([]Hash, error)
+}
+
+// GarbageOptions controls a garbage collection.
+type GarbageOptions struct {
+	// DryRun reports unreachable blocks without deleting them.
+	DryRun bool
+}
+
+// GarbageReport describes the result of a garbage collection.
+// Orphans holds the unreachable blocks that were deleted, or would be deleted in a dry run,
+// and Pending holds the unreachable blocks kept because they were being committed during the collection.
+type GarbageReport struct {
+	Chains  int
+	DryRun  bool
+	Live    int
+	Orphans []Hash
+	Pending []Hash
+}
+
+// CollectGarbage deletes blocks that are not reachable from any chain in the chain store.
+// Every chain is walked, along with the chains of its branches, to mark the blocks in use,
+// and every other block in the block store is then swept.
+// Blocks committed through the service while the collection runs are never swept,
+// since their chains may not have been written when the chains were walked.
+// The block store must implement HashLister.
+func (s *Service) CollectGarbage(opts *GarbageOptions) (*GarbageReport, error) {
+	if opts == nil {
+		opts = &GarbageOptions{}
+	}
+	lister, ok := s.BlockStore.(HashLister)
+	if !ok {
+		return nil, errors.New("the BlockStore provided to the storage service cannot list its blocks")
+	}
+
+	s.commits.startCollection()
+	defer s.commits.finishCollection()
+
+	live, chains, err := s.markBlocks()
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := lister.Hashes()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i] < hashes[j]
+	})
+
+	report := &GarbageReport{
+		Chains:  chains,
+		DryRun:  opts.DryRun,
+		Live:    len(live),
+		Orphans: make([]Hash, 0),
+		Pending: make([]Hash, 0),
+	}
+	for _, hash := range hashes {
+		if live[hash] {
+			continue
+		}
+		swept, err := s.commits.sweep(hash, func() error {
+			if opts.DryRun {
+				return nil
+			}
+			return s.BlockStore.Delete(hash)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if swept {
+			report.Orphans = append(report.Orphans, hash)
+		} else {
+			report.Pending = append(report.Pending, hash)
+		}
+	}
+	return report, nil
+}
+
+// markBlocks walks every chain in the chain store, along with the chains of their branches,
+// and returns the set of blocks they reference and the number of chains walked.
+func (s *Service) markBlocks() (map[Hash]bool, int, error) {
+	live := make(map[Hash]bool)
+	walked := make(map[ChainHash]bool)
+
+	var walk func(c *Chain) error
+	walk = func(c *Chain) error {
+		if walked[c.Hash] {
+			return nil
+		}
+		walked[c.Hash] = true
+
+		c.mux.Lock()
+		for hash := range c.Blocks {
+			live[hash] = true
+		}
+		branches := make([]*Branch, 0, len(c.Branches))
+		for _, b := range c.Branches {
+			branches = append(branches, b)
+		}
+		c.mux.Unlock()
+
+		for _, b := range branches {
+			if walked[b.ToChain] {
+				continue
+			}
+			child, err := s.ReadChain(b.ToChain)
+			if err != nil {
+				// A deleted branched chain leaves nothing to mark.
+				continue
+			}
+			err = walk(child)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var after ChainHash
+	for {
+		page, err := s.ListChains(after, 100)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, info := range page {
+			c, err := s.ReadChain(info.Hash)
+			if err != nil {
+				return nil, 0, err
+			}
+			err = walk(c)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		after = page[len(page)-1].Hash
+	}
+	return live, len(walked), nil
+}
+
+// pendingCommits tracks the blocks being committed through a service, so a garbage collection
+// does not sweep a block whose chain has not yet been written.
+type pendingCommits struct {
+	blocks      map[Hash]int
+	collections int
+	mux         sync.Mutex
+	protected   map[Hash]bool
+}
+
+// begin marks a block as being committed, protecting it from running collections.
+func (p *pendingCommits) begin(hash Hash) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.blocks == nil {
+		p.blocks = make(map[Hash]int)
+	}
+	p.blocks[hash]++
+	if p.collections > 0 {
+		p.protected[hash] = true
+	}
+}
+
+// end marks a block's commit as finished.
+func (p *pendingCommits) end(hash Hash) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.blocks[hash]--
+	if p.blocks[hash] <= 0 {
+		delete(p.blocks, hash)
+	}
+}
+
+// startCollection protects the blocks being committed, and those committed until the
+// collection finishes, from being swept.
+func (p *pendingCommits) startCollection() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.protected == nil {
+		p.protected = make(map[Hash]bool)
+	}
+	for hash := range p.blocks {
+		p.protected[hash] = true
+	}
+	p.collections++
+}
+
+func (p *pendingCommits) finishCollection() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.collections--
+	if p.collections == 0 {
+		p.protected = nil
+	}
+}
+
+// sweep calls fn to remove a block unless it is protected, holding off its commits meanwhile,
+// and reports whether the block was swept.
+func (p *pendingCommits) sweep(hash Hash, fn func() error) (bool, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.protected[hash] || p.blocks[hash] > 0 {
+		return false, nil
+	}
+	return true, fn()
+}
@@ -0,0 +1,85 @@
+package block
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+)
+
+// Header holds every field of a block that the block's hash commits to,
+// with a digest of the block's data in place of the data itself.
+// Headers are enough to verify the continuity of a chain without the blocks' data.
+type Header struct {
+	Author       []byte
+	DataHash     Hash
+	Hash         Hash
+	Index        Index
+	MergeHash    Hash
+	MerkleRoot   Hash
+	PreviousHash Hash
+	Signature    []byte
+	Timestamp    int64
+}
+
+// Signed checks if the header claims an author or carries a signature.
+func (h *Header) Signed() bool {
+	return len(h.Author) > 0 || len(h.Signature) > 0
+}
+
+// Verify checks that the header's hash and signature match its fields.
+func (h *Header) Verify() error {
+	hash, err := h.hash()
+	if err != nil {
+		return err
+	}
+	if hash != h.Hash {
+		return ErrInvalidHash
+	}
+	if h.Signed() {
+		return h.verifySignature()
+	}
+	return nil
+}
+
+// encode returns the canonical encoding of the header.
+// The same encoding is used to generate a block's hash and signature.
+func (h *Header) encode() []byte {
+	var buf bytes.Buffer
+	fields := []string{
+		strconv.Itoa(int(h.Index)),
+		strconv.FormatInt(h.Timestamp, 10),
+		string(h.PreviousHash),
+		string(h.DataHash),
+		string(h.MerkleRoot),
+		string(h.MergeHash),
+		hex.EncodeToString(h.Author),
+	}
+	for _, f := range fields {
+		buf.WriteString(f)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// hash generates the hash of the header's encoding.
+func (h *Header) hash() (Hash, error) {
+	hash, err := common.NewHash(h.encode())
+	if err != nil {
+		return "", err
+	}
+	return Hash(hash), nil
+}
+
+// verifySignature checks the header's signature against its author's public key.
+func (h *Header) verifySignature() error {
+	if len(h.Author) != ed25519.PublicKeySize || len(h.Signature) != ed25519.SignatureSize {
+		return ErrInvalidSignature
+	}
+	if !ed25519.Verify(ed25519.PublicKey(h.Author), h.encode(), h.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
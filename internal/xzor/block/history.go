@@ -0,0 +1,171 @@
+package block
+
+import (
+	"errors"
+	"sort"
+)
+
+// Descendants returns every branch descending from a block of the provided chain.
+// A branch descends from the block when it branched from the block or a later one,
+// and the branches of those branched chains are included as well.
+func (s *Service) Descendants(c *Chain, from Hash) ([]*Branch, error) {
+	c.mux.Lock()
+	index, ok := c.Blocks[from]
+	c.mux.Unlock()
+	if !ok {
+		return nil, ErrInvalidHash
+	}
+	return s.descendants(c, index)
+}
+
+// descendants returns the branches of a chain made at or after the index, along with their descendants.
+func (s *Service) descendants(c *Chain, index Index) ([]*Branch, error) {
+	c.mux.Lock()
+	branches := make([]*Branch, 0)
+	for _, branch := range c.Branches {
+		if i, ok := c.Blocks[branch.FromBlock]; ok && i >= index {
+			branches = append(branches, branch)
+		}
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		a, b := c.Blocks[branches[i].FromBlock], c.Blocks[branches[j].FromBlock]
+		if a != b {
+			return a < b
+		}
+		return branches[i].Hash < branches[j].Hash
+	})
+	c.mux.Unlock()
+
+	descendants := make([]*Branch, 0, len(branches))
+	for _, branch := range branches {
+		descendants = append(descendants, branch)
+		child, err := s.ReadChain(branch.ToChain)
+		if err != nil {
+			return nil, err
+		}
+		more, err := s.descendants(child, 0)
+		if err != nil {
+			return nil, err
+		}
+		descendants = append(descendants, more...)
+	}
+	return descendants, nil
+}
+
+// History returns the hashes of every block in a chain's history, ordered from oldest to newest.
+// The history of a branched chain starts with its parent's history up to and including the
+// block it branched from, and the blocks of merged branches precede the blocks that merged them.
+func (s *Service) History(hash ChainHash) ([]Hash, error) {
+	lineage, err := s.Lineage(hash)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]Hash, 0)
+	for i, c := range lineage {
+		own, err := s.ownHistory(c, map[ChainHash]bool{})
+		if err != nil {
+			return nil, err
+		}
+		if i == len(lineage)-1 {
+			history = append(history, own...)
+			break
+		}
+		next := lineage[i+1].Origin
+		for _, h := range own {
+			history = append(history, h)
+			if h == next.FromBlock {
+				break
+			}
+		}
+	}
+	return history, nil
+}
+
+// Lineage returns a chain along with every chain it branched from, starting with the root chain.
+func (s *Service) Lineage(hash ChainHash) ([]*Chain, error) {
+	lineage := make([]*Chain, 0)
+	seen := make(map[ChainHash]bool)
+	for {
+		if seen[hash] {
+			return nil, errors.New("chain lineage contains a cycle")
+		}
+		seen[hash] = true
+		c, err := s.ReadChain(hash)
+		if err != nil {
+			return nil, err
+		}
+		lineage = append([]*Chain{c}, lineage...)
+		if c.Origin == nil {
+			return lineage, nil
+		}
+		hash = c.Origin.FromChain
+	}
+}
+
+// MergeBranch merges a branch back into its parent chain by appending a merge block
+// that follows the parent's head and references the branch's head.
+func (s *Service) MergeBranch(parent *Chain, hash BranchHash) (*Block, error) {
+	parent.mux.Lock()
+	branch := parent.Branches[hash]
+	parent.mux.Unlock()
+	if branch == nil {
+		return nil, ErrInvalidBranch
+	}
+	child, err := s.ReadChain(branch.ToChain)
+	if err != nil {
+		return nil, err
+	}
+	child.mux.Lock()
+	head := child.LastHash
+	child.mux.Unlock()
+
+	return s.appendBlock(parent, func() (*Block, error) {
+		if branch.MergeBlock != "" {
+			return nil, ErrBranchMerged
+		}
+		b := parent.newBlock(nil)
+		b.MergeHash = head
+		return b, nil
+	}, func(b *Block) func() {
+		branch.MergeBlock = b.Hash
+		return func() {
+			branch.MergeBlock = ""
+		}
+	})
+}
+
+// ownHistory returns the hashes of a chain's own blocks in order,
+// with the blocks of merged branches placed before their merge blocks.
+func (s *Service) ownHistory(c *Chain, visited map[ChainHash]bool) ([]Hash, error) {
+	if visited[c.Hash] {
+		return nil, errors.New("chain merges contain a cycle")
+	}
+	visited[c.Hash] = true
+
+	c.mux.Lock()
+	hashes := c.hashes()
+	merges := make(map[Hash]*Branch)
+	for _, branch := range c.Branches {
+		if branch.MergeBlock != "" {
+			merges[branch.MergeBlock] = branch
+		}
+	}
+	c.mux.Unlock()
+
+	history := make([]Hash, 0, len(hashes))
+	for _, h := range hashes {
+		if branch := merges[h]; branch != nil {
+			child, err := s.ReadChain(branch.ToChain)
+			if err != nil {
+				return nil, err
+			}
+			merged, err := s.ownHistory(child, visited)
+			if err != nil {
+				return nil, err
+			}
+			history = append(history, merged...)
+		}
+		history = append(history, h)
+	}
+	return history, nil
+}
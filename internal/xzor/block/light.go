@@ -0,0 +1,117 @@
+package block
+
+import (
+	"bytes"
+	"errors"
+)
+
+// BodyFetcher fetches complete blocks, such as from peers or a full node.
+type BodyFetcher interface {
+	FetchBlock(Hash) (*Block, error)
+}
+
+// HeaderStore handles storage operations for block headers.
+type HeaderStore interface {
+	Delete(Hash) error
+	Read(Hash) (*Header, error)
+	Write(*Header) error
+}
+
+// HeaderWriter is implemented by block stores that can store headers without their blocks' data.
+type HeaderWriter interface {
+	WriteHeader(*Header) error
+}
+
+var _ Store = &LightStore{}
+var _ HeaderWriter = &LightStore{}
+
+// LightStore implements Store for light nodes.
+// Only the headers of written blocks are kept, and blocks are fetched
+// on demand when read and verified against their stored headers.
+type LightStore struct {
+	Fetcher BodyFetcher
+	Headers HeaderStore
+}
+
+// Delete removes a block's header.
+func (s *LightStore) Delete(hash Hash) error {
+	return s.Headers.Delete(hash)
+}
+
+// Read fetches a block and verifies it against its stored header.
+func (s *LightStore) Read(hash Hash) (*Block, error) {
+	h, err := s.Headers.Read(hash)
+	if err != nil {
+		return nil, err
+	}
+	if s.Fetcher == nil {
+		return nil, errors.New("no Fetcher provided to the light store")
+	}
+	b, err := s.Fetcher.FetchBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	fetched, err := b.Header()
+	if err != nil {
+		return nil, err
+	}
+	if fetched.Hash != h.Hash || !bytes.Equal(fetched.encode(), h.encode()) {
+		return nil, ErrInvalidBody
+	}
+	err = b.verifyMerkleRoot()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// ReadHeader gets a block's header using the block's hash.
+func (s *LightStore) ReadHeader(hash Hash) (*Header, error) {
+	return s.Headers.Read(hash)
+}
+
+// Write stores the block's header and discards its data.
+func (s *LightStore) Write(b *Block) error {
+	h, err := b.Header()
+	if err != nil {
+		return err
+	}
+	return s.Headers.Write(h)
+}
+
+// WriteHeader stores a block's header.
+func (s *LightStore) WriteHeader(h *Header) error {
+	return s.Headers.Write(h)
+}
+
+// AddHeader validates a block's header, adds the block to the chain and writes the header and chain to storage.
+// It requires a block store that implements HeaderWriter, such as LightStore.
+func (s *Service) AddHeader(c *Chain, h *Header) error {
+	hw, ok := s.BlockStore.(HeaderWriter)
+	if !ok {
+		return errors.New("the BlockStore provided to the storage service cannot store headers")
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	prevHash, prevTimestamp := c.LastHash, c.LastTimestamp
+	err := c.addHeader(h)
+	if err != nil {
+		return err
+	}
+	err = hw.WriteHeader(h)
+	if err == nil {
+		err = s.WriteChain(c)
+	}
+	if err != nil {
+		c.removeHead(prevHash, prevTimestamp)
+		return err
+	}
+	return nil
+}
+
+// FetchBlock reads a block from the block store, allowing services of full nodes to serve light nodes.
+func (s *Service) FetchBlock(hash Hash) (*Block, error) {
+	return s.ReadBlock(hash)
+}
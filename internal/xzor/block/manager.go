@@ -0,0 +1,102 @@
+package block
+
+import "sync"
+
+// Manager owns the chains loaded from a service so that every caller shares a single
+// instance of each chain. Appends are serialized per chain by the chain's lock, while
+// appends to different chains proceed concurrently.
+type Manager struct {
+	Service *Service
+
+	chains map[ChainHash]*Chain
+	mux    sync.Mutex
+}
+
+// Append creates a new block holding the data and appends it to the chain.
+func (m *Manager) Append(hash ChainHash, data []byte) (*Block, error) {
+	c, err := m.Chain(hash)
+	if err != nil {
+		return nil, err
+	}
+	return m.Service.NewBlock(c, data)
+}
+
+// Chain returns the loaded chain, reading it from the service's chain store the first time it is requested.
+func (m *Manager) Chain(hash ChainHash) (*Chain, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if c := m.chains[hash]; c != nil {
+		return c, nil
+	}
+	c, err := m.Service.ReadChain(hash)
+	if err != nil {
+		return nil, err
+	}
+	m.load(c)
+	return c, nil
+}
+
+// CompareAndAppend appends a new block holding the data only if the chain's head is
+// still the expected hash, returning ErrHeadMismatch when another block was appended first.
+func (m *Manager) CompareAndAppend(hash ChainHash, expected Hash, data []byte) (*Block, error) {
+	c, err := m.Chain(hash)
+	if err != nil {
+		return nil, err
+	}
+	return m.Service.CompareAndAppend(c, expected, data)
+}
+
+// Head returns the hash of the chain's last block.
+func (m *Manager) Head(hash ChainHash) (Hash, error) {
+	c, err := m.Chain(hash)
+	if err != nil {
+		return "", err
+	}
+	return c.Info().Head, nil
+}
+
+// NewBranch creates a branch from a block of a loaded chain and loads the branched chain.
+func (m *Manager) NewBranch(hash ChainHash, fromBlock *Block) (*Branch, error) {
+	c, err := m.Chain(hash)
+	if err != nil {
+		return nil, err
+	}
+	branch, err := m.Service.NewBranch(c, fromBlock)
+	if err != nil {
+		return nil, err
+	}
+	_, err = m.Chain(branch.ToChain)
+	if err != nil {
+		return nil, err
+	}
+	return branch, nil
+}
+
+// NewChain creates a new chain and loads it.
+func (m *Manager) NewChain() (*Chain, error) {
+	c, err := m.Service.NewChain()
+	if err != nil {
+		return nil, err
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.load(c)
+	return c, nil
+}
+
+// Unload releases a chain so it is read from the chain store the next time it is requested.
+func (m *Manager) Unload(hash ChainHash) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	delete(m.chains, hash)
+}
+
+func (m *Manager) load(c *Chain) {
+	if m.chains == nil {
+		m.chains = make(map[ChainHash]*Chain)
+	}
+	m.chains[c.Hash] = c
+}
@@ -2,35 +2,60 @@ package memory
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/xzor-dev/xzor/internal/xzor/block"
 )
 
 var _ block.Store = &BlockStore{}
+var _ block.HashLister = &BlockStore{}
 
 // BlockStore handles the storage of blocks within memory.
 type BlockStore struct {
 	blocks map[block.Hash]*block.Block
+	mux    sync.RWMutex
 }
 
 // Delete removes a block from the store.
 func (s *BlockStore) Delete(hash block.Hash) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	if s.blocks != nil {
 		delete(s.blocks, hash)
 	}
 	return nil
 }
 
+// Hashes returns the hashes of every block in memory.
+func (s *BlockStore) Hashes() ([]block.Hash, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	hashes := make([]block.Hash, 0, len(s.blocks))
+	for hash := range s.blocks {
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
 // Read attempts to get a block using its hash.
 func (s *BlockStore) Read(hash block.Hash) (*block.Block, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
 	if s.blocks == nil || s.blocks[hash] == nil {
 		return nil, errors.New("invalid block hash")
 	}
-	return s.blocks[hash], nil
+	b := *s.blocks[hash]
+	return &b, nil
 }
 
 // Write adds or overwrites a block using its hash.
 func (s *BlockStore) Write(b *block.Block) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	if s.blocks == nil {
 		s.blocks = make(map[block.Hash]*block.Block)
 	}
@@ -1,7 +1,8 @@
 package memory
 
 import (
-	"errors"
+	"sort"
+	"sync"
 
 	"github.com/xzor-dev/xzor/internal/xzor/block"
 )
@@ -9,31 +10,79 @@ import (
 var _ block.ChainStore = &ChainStore{}
 
 // ChainStore implements block.ChainStore to store chain data in memory.
+// Chains are copied when written and read, so callers never share a chain through the store.
 type ChainStore struct {
 	chains map[block.ChainHash]*block.Chain
+	mux    sync.RWMutex
 }
 
 // Delete removes a chain from storage using its hash.
 func (s *ChainStore) Delete(hash block.ChainHash) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	if s.chains != nil {
 		delete(s.chains, hash)
 	}
 	return nil
 }
 
+// Find returns the chains in memory matching the query.
+func (s *ChainStore) Find(q *block.ChainQuery) ([]*block.ChainInfo, error) {
+	chains, err := s.List("", 0)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]*block.ChainInfo, 0)
+	for _, info := range chains {
+		if q.Match(info) {
+			found = append(found, info)
+		}
+	}
+	return found, nil
+}
+
+// List returns chains in memory ordered by hash, starting after the provided hash.
+func (s *ChainStore) List(after block.ChainHash, limit int) ([]*block.ChainInfo, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	hashes := make([]string, 0, len(s.chains))
+	for hash := range s.chains {
+		if hash > after {
+			hashes = append(hashes, string(hash))
+		}
+	}
+	sort.Strings(hashes)
+	if limit > 0 && len(hashes) > limit {
+		hashes = hashes[:limit]
+	}
+	chains := make([]*block.ChainInfo, len(hashes))
+	for i, hash := range hashes {
+		chains[i] = s.chains[block.ChainHash(hash)].Info()
+	}
+	return chains, nil
+}
+
 // Read attempts to get a chain from memory using its hash.
 func (s *ChainStore) Read(hash block.ChainHash) (*block.Chain, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
 	if s.chains == nil || s.chains[hash] == nil {
-		return nil, errors.New("invalid chain hash")
+		return nil, block.ErrChainNotFound
 	}
-	return s.chains[hash], nil
+	return s.chains[hash].Copy(), nil
 }
 
 // Write adds or replaces a chain in memory.
 func (s *ChainStore) Write(c *block.Chain) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	if s.chains == nil {
 		s.chains = make(map[block.ChainHash]*block.Chain)
 	}
-	s.chains[c.Hash] = c
+	s.chains[c.Hash] = c.Copy()
 	return nil
 }
@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+)
+
+var _ block.HeaderStore = &HeaderStore{}
+
+// HeaderStore handles the storage of block headers within memory.
+type HeaderStore struct {
+	headers map[block.Hash]*block.Header
+	mux     sync.RWMutex
+}
+
+// Delete removes a header from the store.
+func (s *HeaderStore) Delete(hash block.Hash) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.headers != nil {
+		delete(s.headers, hash)
+	}
+	return nil
+}
+
+// Read attempts to get a header using its block's hash.
+func (s *HeaderStore) Read(hash block.Hash) (*block.Header, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if s.headers == nil || s.headers[hash] == nil {
+		return nil, errors.New("invalid block hash")
+	}
+	return s.headers[hash], nil
+}
+
+// Write adds or overwrites a header using its block's hash.
+func (s *HeaderStore) Write(h *block.Header) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.headers == nil {
+		s.headers = make(map[block.Hash]*block.Header)
+	}
+	if h.Hash == "" {
+		return errors.New("header does not have a hash")
+	}
+	s.headers[h.Hash] = h
+	return nil
+}
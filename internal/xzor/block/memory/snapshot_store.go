@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+)
+
+var _ block.SnapshotStore = &SnapshotStore{}
+
+// SnapshotStore implements block.SnapshotStore to store snapshots in memory.
+type SnapshotStore struct {
+	snapshots map[block.ChainHash]*block.Snapshot
+	mux       sync.RWMutex
+}
+
+// Delete removes a chain's snapshot from memory.
+func (s *SnapshotStore) Delete(hash block.ChainHash) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.snapshots != nil {
+		delete(s.snapshots, hash)
+	}
+	return nil
+}
+
+// Read attempts to get a chain's snapshot from memory.
+func (s *SnapshotStore) Read(hash block.ChainHash) (*block.Snapshot, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if s.snapshots == nil || s.snapshots[hash] == nil {
+		return nil, errors.New("invalid chain hash")
+	}
+	return s.snapshots[hash], nil
+}
+
+// Write adds or replaces a chain's snapshot in memory.
+func (s *SnapshotStore) Write(snapshot *block.Snapshot) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.snapshots == nil {
+		s.snapshots = make(map[block.ChainHash]*block.Snapshot)
+	}
+	s.snapshots[snapshot.Chain] = snapshot
+	return nil
+}
@@ -0,0 +1,189 @@
+package block
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+)
+
+// Prefixes used to separate leaf and node hashes within a merkle tree,
+// preventing an inner node from being passed off as a leaf.
+const (
+	merkleLeafPrefix byte = 0x00
+	merkleNodePrefix byte = 0x01
+)
+
+// MerkleProof proves that an item is included in a merkle root.
+// Each step records which side its sibling is on, since levels where the item's
+// node has no sibling are skipped.
+type MerkleProof struct {
+	Steps []*MerkleProofStep
+}
+
+// Verify checks that the item is included in the provided merkle root.
+func (p *MerkleProof) Verify(root Hash, item []byte) error {
+	hash := merkleLeaf(item)
+	for _, step := range p.Steps {
+		sibling, err := hex.DecodeString(string(step.Hash))
+		if err != nil {
+			return ErrInvalidProof
+		}
+		if step.Left {
+			hash = merkleNode(sibling, hash)
+		} else {
+			hash = merkleNode(hash, sibling)
+		}
+	}
+	if Hash(hex.EncodeToString(hash)) != root {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// MerkleProofStep holds a sibling hash along the path from an item to the merkle root.
+// Left indicates that the sibling is on the left side of the pair.
+type MerkleProofStep struct {
+	Hash Hash
+	Left bool
+}
+
+// DecodeItems splits data created by EncodeItems back into individual items.
+func DecodeItems(data []byte) ([][]byte, error) {
+	items := make([][]byte, 0)
+	for len(data) > 0 {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < size {
+			return nil, errors.New("invalid item encoding")
+		}
+		data = data[n:]
+		items = append(items, data[:size])
+		data = data[size:]
+	}
+	return items, nil
+}
+
+// EncodeItems joins items into a single byte slice suitable for a block's data.
+func EncodeItems(items [][]byte) []byte {
+	var buf bytes.Buffer
+	size := make([]byte, binary.MaxVarintLen64)
+	for _, item := range items {
+		n := binary.PutUvarint(size, uint64(len(item)))
+		buf.Write(size[:n])
+		buf.Write(item)
+	}
+	return buf.Bytes()
+}
+
+// MerkleRoot calculates the merkle root of the provided items.
+func MerkleRoot(items [][]byte) (Hash, error) {
+	if len(items) == 0 {
+		return "", ErrEmptyBatch
+	}
+	level := make([][]byte, len(items))
+	for i, item := range items {
+		level[i] = merkleLeaf(item)
+	}
+	for len(level) > 1 {
+		level = merkleLevel(level)
+	}
+	return Hash(hex.EncodeToString(level[0])), nil
+}
+
+// NewMerkleProof creates a proof that the item at index i is included in the items' merkle root.
+func NewMerkleProof(items [][]byte, i int) (*MerkleProof, error) {
+	if len(items) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if i < 0 || i >= len(items) {
+		return nil, errors.New("item index out of range")
+	}
+	level := make([][]byte, len(items))
+	for j, item := range items {
+		level[j] = merkleLeaf(item)
+	}
+
+	proof := &MerkleProof{
+		Steps: make([]*MerkleProofStep, 0),
+	}
+	pos := i
+	for len(level) > 1 {
+		sibling := pos ^ 1
+		if sibling < len(level) {
+			proof.Steps = append(proof.Steps, &MerkleProofStep{
+				Hash: Hash(hex.EncodeToString(level[sibling])),
+				Left: sibling < pos,
+			})
+		}
+		level = merkleLevel(level)
+		pos /= 2
+	}
+	return proof, nil
+}
+
+// merkleLeaf hashes a single item.
+func merkleLeaf(item []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(item)
+	return h.Sum(nil)
+}
+
+// merkleLevel hashes pairs of nodes into the next level of the tree.
+// An unpaired node is promoted to the next level as-is.
+func merkleLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+		next = append(next, merkleNode(level[i], level[i+1]))
+	}
+	return next
+}
+
+// merkleNode hashes a pair of child nodes.
+func merkleNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Items decodes the block's data into the items committed to by its merkle root.
+func (b *Block) Items() ([][]byte, error) {
+	if b.MerkleRoot == "" {
+		return nil, errors.New("block does not have a merkle root")
+	}
+	return DecodeItems(b.Data)
+}
+
+// Proof creates an inclusion proof for the block's item at index i.
+func (b *Block) Proof(i int) (*MerkleProof, error) {
+	items, err := b.Items()
+	if err != nil {
+		return nil, err
+	}
+	return NewMerkleProof(items, i)
+}
+
+// verifyMerkleRoot checks that the block's merkle root matches its data.
+// Blocks without a merkle root are not checked, while a block claiming a root
+// without any data is rejected.
+func (b *Block) verifyMerkleRoot() error {
+	if b.MerkleRoot == "" {
+		return nil
+	}
+	items, err := DecodeItems(b.Data)
+	if err != nil {
+		return ErrInvalidMerkleRoot
+	}
+	root, err := MerkleRoot(items)
+	if err != nil || root != b.MerkleRoot {
+		return ErrInvalidMerkleRoot
+	}
+	return nil
+}
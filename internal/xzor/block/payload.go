@@ -0,0 +1,170 @@
+package block
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// payloadMagic prefixes block data that is wrapped in a payload envelope.
+var payloadMagic = []byte("XZPL")
+
+// Encodings supported for payload data.
+const (
+	EncodingJSON Encoding = "json"
+	EncodingRaw  Encoding = "raw"
+)
+
+// Encoding names the format of a payload's data.
+type Encoding string
+
+// Payload is an envelope describing the data stored in a block,
+// allowing any block to be decoded without guessing at its contents.
+type Payload struct {
+	Data     []byte
+	Encoding Encoding
+	Type     PayloadType
+	Version  uint64
+}
+
+// DecodePayload unwraps a payload envelope created by EncodePayload.
+// ErrUntypedPayload is returned for data that is not wrapped in an envelope.
+func DecodePayload(data []byte) (*Payload, error) {
+	if !bytes.HasPrefix(data, payloadMagic) {
+		return nil, ErrUntypedPayload
+	}
+	data = data[len(payloadMagic):]
+
+	typ, data, err := decodePayloadField(data)
+	if err != nil {
+		return nil, err
+	}
+	version, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, errors.New("invalid payload version")
+	}
+	data = data[n:]
+	encoding, data, err := decodePayloadField(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Payload{
+		Data:     data,
+		Encoding: Encoding(encoding),
+		Type:     PayloadType(typ),
+		Version:  version,
+	}, nil
+}
+
+// EncodePayload wraps a payload in an envelope suitable for a block's data.
+func EncodePayload(p *Payload) ([]byte, error) {
+	if p.Type == "" {
+		return nil, errors.New("payload type is required")
+	}
+	var buf bytes.Buffer
+	buf.Write(payloadMagic)
+	size := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(size, uint64(len(p.Type)))
+	buf.Write(size[:n])
+	buf.WriteString(string(p.Type))
+	n = binary.PutUvarint(size, p.Version)
+	buf.Write(size[:n])
+	n = binary.PutUvarint(size, uint64(len(p.Encoding)))
+	buf.Write(size[:n])
+	buf.WriteString(string(p.Encoding))
+	buf.Write(p.Data)
+	return buf.Bytes(), nil
+}
+
+func decodePayloadField(data []byte) (string, []byte, error) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return "", nil, errors.New("invalid payload encoding")
+	}
+	data = data[n:]
+	return string(data[:size]), data[size:], nil
+}
+
+// PayloadDecoder converts a payload's data into a value.
+// Decoders receive the payload's version and encoding so older schemas can still be read.
+type PayloadDecoder interface {
+	DecodePayload(*Payload) (interface{}, error)
+}
+
+// PayloadDecoderFunc allows a function to be used as a PayloadDecoder.
+type PayloadDecoderFunc func(*Payload) (interface{}, error)
+
+// DecodePayload calls the function.
+func (f PayloadDecoderFunc) DecodePayload(p *Payload) (interface{}, error) {
+	return f(p)
+}
+
+// PayloadRegistry maps payload types to the decoders registered by modules.
+type PayloadRegistry struct {
+	decoders map[PayloadType]PayloadDecoder
+	mux      sync.RWMutex
+}
+
+// Decode unwraps a block's data and decodes it using the decoder registered for its type.
+func (r *PayloadRegistry) Decode(data []byte) (interface{}, error) {
+	p, err := DecodePayload(data)
+	if err != nil {
+		return nil, err
+	}
+	r.mux.RLock()
+	d := r.decoders[p.Type]
+	r.mux.RUnlock()
+	if d == nil {
+		return nil, ErrUnknownPayload
+	}
+	return d.DecodePayload(p)
+}
+
+// Register adds a decoder for a payload type.
+func (r *PayloadRegistry) Register(t PayloadType, d PayloadDecoder) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.decoders == nil {
+		r.decoders = make(map[PayloadType]PayloadDecoder)
+	}
+	if r.decoders[t] != nil {
+		return ErrPayloadRegistered
+	}
+	r.decoders[t] = d
+	return nil
+}
+
+// Types returns the registered payload types in sorted order.
+func (r *PayloadRegistry) Types() []PayloadType {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	types := make([]PayloadType, 0, len(r.decoders))
+	for t := range r.decoders {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	return types
+}
+
+// PayloadType identifies the kind of data held by a payload, such as "xzor.action".
+type PayloadType string
+
+// Payload unwraps the block's data from its payload envelope.
+func (b *Block) Payload() (*Payload, error) {
+	return DecodePayload(b.Data)
+}
+
+// NewPayloadBlock wraps a payload in an envelope and appends it to the chain as a new block.
+func (s *Service) NewPayloadBlock(c *Chain, p *Payload) (*Block, error) {
+	data, err := EncodePayload(p)
+	if err != nil {
+		return nil, err
+	}
+	return s.NewBlock(c, data)
+}
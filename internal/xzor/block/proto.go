@@ -0,0 +1,47 @@
+package block
+
+import (
+	"errors"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// FromProto sets the block's fields from its protobuf message.
+func (b *Block) FromProto(m proto.Message) error {
+	p, ok := m.(*pb.Block)
+	if !ok {
+		return errors.New("unexpected protobuf message type")
+	}
+	b.Author = p.Author
+	b.Data = p.Data
+	b.Hash = Hash(p.Hash)
+	b.Index = Index(p.Index)
+	b.MergeHash = Hash(p.MergeHash)
+	b.MerkleRoot = Hash(p.MerkleRoot)
+	b.PreviousHash = Hash(p.PreviousHash)
+	b.Signature = p.Signature
+	b.Timestamp = p.Timestamp
+	return nil
+}
+
+// NewProto returns an empty protobuf message for decoding a block.
+func (b *Block) NewProto() proto.Message {
+	return &pb.Block{}
+}
+
+// ToProto converts the block into its protobuf message, allowing blocks to be stored
+// using the protobuf record encoding.
+func (b *Block) ToProto() proto.Message {
+	return &pb.Block{
+		Author:       b.Author,
+		Data:         b.Data,
+		Hash:         string(b.Hash),
+		Index:        int64(b.Index),
+		MergeHash:    string(b.MergeHash),
+		MerkleRoot:   string(b.MerkleRoot),
+		PreviousHash: string(b.PreviousHash),
+		Signature:    b.Signature,
+		Timestamp:    b.Timestamp,
+	}
+}
@@ -0,0 +1,499 @@
+package segment
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+)
+
+// DefaultMaxSegmentSize is the segment size used when a store does not provide one.
+const DefaultMaxSegmentSize = 64 << 20
+
+const (
+	segmentExt = ".seg"
+	indexFile  = "index"
+
+	opWrite  byte = 1
+	opDelete byte = 2
+)
+
+// ErrCorruptSegment occurs when a record within a sealed segment fails its checksum.
+var ErrCorruptSegment = errors.New("corrupt segment")
+
+// SyncPolicy determines when segment files are flushed to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways flushes the active segment after every write.
+	SyncAlways SyncPolicy = iota
+
+	// SyncOnRotate flushes segments only when they are rotated or the store is closed.
+	SyncOnRotate
+
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+var _ block.Store = &BlockStore{}
+var _ block.HashLister = &BlockStore{}
+
+// BlockStore stores blocks in append-only segment files.
+// Every write or delete is appended as a checksummed record to the active segment,
+// which is rotated once it reaches MaxSegmentSize. An index of block hashes to record
+// offsets is kept in memory and persisted when segments rotate and when the store is closed.
+// Records appended after the last persisted index are recovered by scanning the segments.
+type BlockStore struct {
+	MaxSegmentSize int64
+	RootDir        string
+	SyncPolicy     SyncPolicy
+
+	active  *os.File
+	index   map[block.Hash]*location
+	mux     sync.Mutex
+	readers map[int]*os.File
+	segment int
+	size    int64
+}
+
+// location points to a record within a segment.
+type location struct {
+	Length  uint32
+	Offset  int64
+	Segment int
+}
+
+// Close flushes the active segment, persists the index and closes all open files.
+func (s *BlockStore) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.index == nil {
+		return nil
+	}
+	err := s.active.Sync()
+	if err != nil {
+		return err
+	}
+	err = s.writeIndex()
+	if err != nil {
+		return err
+	}
+	for _, f := range s.readers {
+		f.Close()
+	}
+	err = s.active.Close()
+	s.active = nil
+	s.index = nil
+	s.readers = nil
+	return err
+}
+
+// Delete appends a tombstone for the block and removes it from the index.
+func (s *BlockStore) Delete(hash block.Hash) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	err := s.open()
+	if err != nil {
+		return err
+	}
+	if s.index[hash] == nil {
+		return nil
+	}
+	_, err = s.append(opDelete, hash, nil)
+	if err != nil {
+		return err
+	}
+	delete(s.index, hash)
+	return nil
+}
+
+// Hashes returns the hashes of every block in the store.
+func (s *BlockStore) Hashes() ([]block.Hash, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]block.Hash, 0, len(s.index))
+	for hash := range s.index {
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// Read gets a block using its hash.
+func (s *BlockStore) Read(hash block.Hash) (*block.Block, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	loc := s.index[hash]
+	if loc == nil {
+		return nil, errors.New("invalid block hash")
+	}
+	f, err := s.reader(loc.Segment)
+	if err != nil {
+		return nil, err
+	}
+	rec := make([]byte, loc.Length)
+	_, err = f.ReadAt(rec, loc.Offset)
+	if err != nil {
+		return nil, err
+	}
+	op, _, data, err := decodeRecord(rec)
+	if err != nil {
+		return nil, err
+	}
+	if op != opWrite {
+		return nil, ErrCorruptSegment
+	}
+	b := &block.Block{}
+	err = json.Unmarshal(data, b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Write appends a block to the active segment.
+func (s *BlockStore) Write(b *block.Block) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if b.Hash == "" {
+		return errors.New("block does not have a hash")
+	}
+	err := s.open()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	loc, err := s.append(opWrite, b.Hash, data)
+	if err != nil {
+		return err
+	}
+	s.index[b.Hash] = loc
+	return nil
+}
+
+// append writes a record to the active segment, rotating it first when it is full.
+func (s *BlockStore) append(op byte, hash block.Hash, data []byte) (*location, error) {
+	rec := encodeRecord(op, hash, data)
+	if s.size > 0 && s.size+int64(len(rec)) > s.maxSegmentSize() {
+		err := s.rotate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err := s.active.Write(rec)
+	if err != nil {
+		return nil, err
+	}
+	if s.SyncPolicy == SyncAlways {
+		err = s.active.Sync()
+		if err != nil {
+			return nil, err
+		}
+	}
+	loc := &location{
+		Length:  uint32(len(rec)),
+		Offset:  s.size,
+		Segment: s.segment,
+	}
+	s.size += int64(len(rec))
+	return loc, nil
+}
+
+func (s *BlockStore) maxSegmentSize() int64 {
+	if s.MaxSegmentSize <= 0 {
+		return DefaultMaxSegmentSize
+	}
+	return s.MaxSegmentSize
+}
+
+// open loads the index and recovers any records written after it was persisted.
+func (s *BlockStore) open() error {
+	if s.index != nil {
+		return nil
+	}
+	err := os.MkdirAll(s.RootDir, 0755)
+	if err != nil {
+		return err
+	}
+	// Remove index files left half written by a crash.
+	err = common.RemoveTempFiles(s.RootDir)
+	if err != nil {
+		return err
+	}
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+
+	index, covered, err := s.readIndex()
+	if err != nil {
+		index = make(map[block.Hash]*location)
+		covered = location{}
+	}
+	s.index = index
+	s.readers = make(map[int]*os.File)
+
+	for i, id := range segments {
+		if id < covered.Segment {
+			continue
+		}
+		offset := int64(0)
+		if id == covered.Segment {
+			offset = covered.Offset
+		}
+		last := i == len(segments)-1
+		end, err := s.scan(id, offset, last)
+		if err != nil {
+			s.index = nil
+			return err
+		}
+		if last {
+			s.segment = id
+			s.size = end
+		}
+	}
+	if len(segments) == 0 {
+		s.segment = 1
+		s.size = 0
+	}
+
+	s.active, err = os.OpenFile(s.segmentName(s.segment), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		s.index = nil
+		return err
+	}
+	_, err = s.active.Seek(s.size, io.SeekStart)
+	if err != nil {
+		s.index = nil
+		return err
+	}
+	return nil
+}
+
+// reader returns a read handle for a segment.
+func (s *BlockStore) reader(id int) (*os.File, error) {
+	if f := s.readers[id]; f != nil {
+		return f, nil
+	}
+	f, err := os.Open(s.segmentName(id))
+	if err != nil {
+		return nil, err
+	}
+	s.readers[id] = f
+	return f, nil
+}
+
+// rotate seals the active segment and starts a new one.
+func (s *BlockStore) rotate() error {
+	if s.SyncPolicy != SyncNever {
+		err := s.active.Sync()
+		if err != nil {
+			return err
+		}
+	}
+	err := s.active.Close()
+	if err != nil {
+		return err
+	}
+	s.segment++
+	s.size = 0
+	s.active, err = os.OpenFile(s.segmentName(s.segment), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	return s.writeIndex()
+}
+
+// scan applies the records of a segment to the index starting at offset and returns the segment's end.
+// A damaged record at the end of the last segment is treated as an interrupted write and truncated.
+func (s *BlockStore) scan(id int, offset int64, last bool) (int64, error) {
+	name := s.segmentName(id)
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	pos := offset
+	for pos < int64(len(data)) {
+		n, op, hash, err := readRecord(data[pos:])
+		if err != nil {
+			if !last {
+				return 0, fmt.Errorf("%v: segment %d at offset %d", ErrCorruptSegment, id, pos)
+			}
+			err = os.Truncate(name, pos)
+			if err != nil {
+				return 0, err
+			}
+			break
+		}
+		switch op {
+		case opWrite:
+			s.index[hash] = &location{
+				Length:  uint32(n),
+				Offset:  pos,
+				Segment: id,
+			}
+		case opDelete:
+			delete(s.index, hash)
+		}
+		pos += int64(n)
+	}
+	return pos, nil
+}
+
+func (s *BlockStore) segmentName(id int) string {
+	return fmt.Sprintf("%s/%08d%s", s.RootDir, id, segmentExt)
+}
+
+// segments returns the IDs of all segments in ascending order.
+func (s *BlockStore) segments() ([]int, error) {
+	files, err := ioutil.ReadDir(s.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0)
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// readIndex loads the persisted index along with the position it covers up to.
+func (s *BlockStore) readIndex() (map[block.Hash]*location, location, error) {
+	var covered location
+	data, err := ioutil.ReadFile(s.RootDir + "/" + indexFile)
+	if err != nil {
+		return nil, covered, err
+	}
+	if len(data) < 4 {
+		return nil, covered, errors.New("invalid index")
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, covered, errors.New("invalid index checksum")
+	}
+	idx := &persistedIndex{}
+	err = json.Unmarshal(body, idx)
+	if err != nil {
+		return nil, covered, err
+	}
+	if idx.Blocks == nil {
+		idx.Blocks = make(map[block.Hash]*location)
+	}
+	return idx.Blocks, idx.Covered, nil
+}
+
+// writeIndex persists the index along with the position of the active segment.
+func (s *BlockStore) writeIndex() error {
+	body, err := json.Marshal(&persistedIndex{
+		Blocks: s.index,
+		Covered: location{
+			Offset:  s.size,
+			Segment: s.segment,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(body))
+
+	// The index is replaced atomically, so a crash leaves either the previous index or the new one.
+	return common.WriteFile(s.RootDir+"/"+indexFile, append(body, sum...), 0644)
+}
+
+type persistedIndex struct {
+	Blocks  map[block.Hash]*location
+	Covered location
+}
+
+// encodeRecord creates a segment record. Records are laid out as a 4 byte length,
+// a 4 byte CRC-32 of the body and the body itself, which holds the operation,
+// the length-prefixed block hash and the block's data.
+func encodeRecord(op byte, hash block.Hash, data []byte) []byte {
+	body := make([]byte, 0, 1+2+len(hash)+len(data))
+	body = append(body, op)
+	body = append(body, byte(len(hash)>>8), byte(len(hash)))
+	body = append(body, hash...)
+	body = append(body, data...)
+
+	rec := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(rec[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(body))
+	return append(rec, body...)
+}
+
+// decodeRecord verifies a complete record and splits it into its parts.
+func decodeRecord(rec []byte) (byte, block.Hash, []byte, error) {
+	if len(rec) < 8 {
+		return 0, "", nil, ErrCorruptSegment
+	}
+	size := binary.BigEndian.Uint32(rec[0:4])
+	if uint64(len(rec)-8) != uint64(size) {
+		return 0, "", nil, ErrCorruptSegment
+	}
+	body := rec[8:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(rec[4:8]) {
+		return 0, "", nil, ErrCorruptSegment
+	}
+	if len(body) < 3 {
+		return 0, "", nil, ErrCorruptSegment
+	}
+	hashLen := int(body[1])<<8 | int(body[2])
+	if len(body) < 3+hashLen {
+		return 0, "", nil, ErrCorruptSegment
+	}
+	hash := block.Hash(body[3 : 3+hashLen])
+	return body[0], hash, body[3+hashLen:], nil
+}
+
+// readRecord decodes the record at the start of data and returns its total length.
+func readRecord(data []byte) (int, byte, block.Hash, error) {
+	if len(data) < 8 {
+		return 0, 0, "", ErrCorruptSegment
+	}
+	size := binary.BigEndian.Uint32(data[0:4])
+	if uint64(len(data)-8) < uint64(size) {
+		return 0, 0, "", ErrCorruptSegment
+	}
+	n := 8 + int(size)
+	op, hash, _, err := decodeRecord(data[:n])
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return n, op, hash, nil
+}
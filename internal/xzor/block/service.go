@@ -1,52 +1,191 @@
 package block
 
-import "errors"
+import (
+	"encoding/hex"
+	"errors"
+	"time"
+)
 
 // Service facilitates the creation and management of stored data.
+// Clock and MaxClockSkew are applied to the chains the service creates and reads.
 type Service struct {
-	BlockStore Store
-	ChainStore ChainStore
+	BlockStore      Store
+	ChainStore      ChainStore
+	Clock           Clock
+	Committer       Committer
+	MaxClockSkew    time.Duration
+	Mode            Mode
+	SignaturePolicy SignaturePolicy
+	Signer          Signer
+	SnapshotStore   SnapshotStore
+
+	commits pendingCommits
+	events  eventHub
 }
 
-// NewBlock creates a new block for the provided chain and
-// guarantees it as a valid next block on the chain.
+// NewBlock creates a new block holding the provided data, appends it to the chain
+// and commits both the block and the updated chain to storage.
+// If the commit fails, the block is removed from the chain.
 func (s *Service) NewBlock(c *Chain, data []byte) (*Block, error) {
-	for {
-		b := c.NewBlock(nil)
-		err := c.AddBlock(b)
-		if err == ErrInvalidPrevHash {
-			continue
-		} else if err != nil {
-			return nil, err
+	return s.appendBlock(c, func() (*Block, error) {
+		return c.newBlock(data), nil
+	}, nil)
+}
+
+// NewBatchBlock creates a new block holding the provided items and their merkle root,
+// then appends and commits it the same way as NewBlock.
+func (s *Service) NewBatchBlock(c *Chain, items [][]byte) (*Block, error) {
+	return s.appendBlock(c, func() (*Block, error) {
+		return c.newBatchBlock(items)
+	}, nil)
+}
+
+// CompareAndAppend creates a new block only if the chain's head is still the expected hash,
+// returning ErrHeadMismatch when another block was appended first.
+func (s *Service) CompareAndAppend(c *Chain, expected Hash, data []byte) (*Block, error) {
+	return s.appendBlock(c, func() (*Block, error) {
+		if c.LastHash != expected {
+			return nil, ErrHeadMismatch
 		}
-		return b, nil
+		return c.newBlock(data), nil
+	}, nil)
+}
+
+// AddBlock validates a block created elsewhere, such as one received from a peer,
+// adds it to the chain and commits it the same way as NewBlock.
+func (s *Service) AddBlock(c *Chain, b *Block) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return s.addBlock(c, b, nil)
+}
+
+// appendBlock creates, signs and adds a block to the locked chain, then commits it.
+// The optional link function is called after the block is added to the chain and
+// before it is committed, allowing the chain to be updated to reference the block.
+// The function it returns is used to undo that update if the commit fails.
+func (s *Service) appendBlock(c *Chain, newBlock func() (*Block, error), link func(*Block) func()) (*Block, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	b, err := newBlock()
+	if err != nil {
+		return nil, err
+	}
+	err = s.signBlock(b)
+	if err != nil {
+		return nil, err
+	}
+	err = s.addBlock(c, b, link)
+	if err != nil {
+		return nil, err
 	}
+	return b, nil
 }
 
+// addBlock adds a block to the locked chain, commits it and publishes its event.
+// The block is removed from the chain if the commit fails.
+func (s *Service) addBlock(c *Chain, b *Block, link func(*Block) func()) error {
+	prevHash, prevTimestamp := c.LastHash, c.LastTimestamp
+	err := c.addBlock(b)
+	if err != nil {
+		return err
+	}
+	undo := func() {}
+	if link != nil {
+		undo = link(b)
+	}
+	err = s.commit(b, c)
+	if err != nil {
+		undo()
+		c.removeHead(prevHash, prevTimestamp)
+		return err
+	}
+	s.events.publish(&Event{
+		Block: b,
+		Chain: c.Hash,
+		Head:  b.Hash,
+		Type:  BlockAppended,
+	})
+	return nil
+}
+
+// commit writes a block and its chain to storage.
+// The service's Committer is used when available. Otherwise the block is written
+// before the chain, so an interrupted commit never leaves the chain referencing a missing block.
+func (s *Service) commit(b *Block, c *Chain) error {
+	s.commits.begin(b.Hash)
+	defer s.commits.end(b.Hash)
+
+	if s.Committer != nil {
+		return s.Committer.Commit(b, c)
+	}
+	if s.BlockStore == nil {
+		return errors.New("no BlockStore provided to the storage service")
+	}
+	if s.ChainStore == nil {
+		return errors.New("no ChainStore provided to the storage service")
+	}
+	err := s.BlockStore.Write(b)
+	if err != nil {
+		return err
+	}
+	return s.ChainStore.Write(c)
+}
+
+// DeleteBlock removes a block from the block store.
 func (s *Service) DeleteBlock(hash Hash) error {
 	return s.BlockStore.Delete(hash)
 }
 
+// ReadBlock reads a block from the block store using its hash.
 func (s *Service) ReadBlock(hash Hash) (*Block, error) {
 	return s.BlockStore.Read(hash)
 }
 
+// WriteBlock writes a block to the block store.
 func (s *Service) WriteBlock(b *Block) error {
 	return s.BlockStore.Write(b)
 }
 
 // NewBranch creates a branch from a chain's block.
+// The branched chain's genesis block continues from the block it branched from,
+// and both chains are written to the chain store.
 func (s *Service) NewBranch(fromChain *Chain, fromBlock *Block) (*Branch, error) {
-	c2, err := s.NewChain()
+	hash, err := NewChainHash()
 	if err != nil {
 		return nil, err
 	}
+	c2 := s.newChain(hash)
 
 	branch, err := fromChain.NewBranch(fromBlock, c2)
 	if err != nil {
 		return nil, err
 	}
+	c2.Origin = branch
 
+	_, err = s.appendBlock(c2, func() (*Block, error) {
+		b := c2.newBlock(nil)
+		b.Index = fromBlock.Index + 1
+		b.PreviousHash = fromBlock.Hash
+		return b, nil
+	}, nil)
+	fromChain.mux.Lock()
+	defer fromChain.mux.Unlock()
+	if err == nil {
+		err = s.WriteChain(fromChain)
+	}
+	if err != nil {
+		delete(fromChain.Branches, branch.Hash)
+		return nil, err
+	}
+
+	s.events.publish(&Event{
+		Branch: branch,
+		Chain:  fromChain.Hash,
+		Head:   fromChain.LastHash,
+		Type:   BranchCreated,
+	})
 	return branch, nil
 }
 
@@ -58,31 +197,102 @@ func (s *Service) DeleteChain(hash ChainHash) error {
 	return s.ChainStore.Delete(hash)
 }
 
-// NewChain creates new chain with a genesis block.
+// signBlock signs the block when the service has a signer.
+func (s *Service) signBlock(b *Block) error {
+	if s.Signer == nil {
+		return nil
+	}
+	return b.Sign(s.Signer)
+}
+
+// newChain creates an empty chain owned by the service's signer, if any.
+func (s *Service) newChain(hash ChainHash) *Chain {
+	c := &Chain{
+		Blocks:           make(map[Hash]Index),
+		Branches:         make(map[BranchHash]*Branch),
+		Clock:            s.Clock,
+		Created:          Timestamp(s.now()),
+		Hash:             hash,
+		MaxClockSkew:     s.MaxClockSkew,
+		SignaturePolicy:  s.SignaturePolicy,
+		TimestampVersion: MillisecondTimestamps,
+	}
+	if s.Signer != nil {
+		c.Owner = hex.EncodeToString(s.Signer.PublicKey())
+	}
+	return c
+}
+
+// DescribeChain sets the chain's description and writes it to the chain store.
+func (s *Service) DescribeChain(c *Chain, description string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.Description = description
+	return s.WriteChain(c)
+}
+
+// FindChains returns the chains in the chain store matching the query.
+func (s *Service) FindChains(q *ChainQuery) ([]*ChainInfo, error) {
+	if s.ChainStore == nil {
+		return nil, errors.New("no ChainStore provided to the storage service")
+	}
+	return s.ChainStore.Find(q)
+}
+
+// ListChains returns a page of chains from the chain store ordered by hash.
+// The next page starts after the hash of the last chain returned.
+func (s *Service) ListChains(after ChainHash, limit int) ([]*ChainInfo, error) {
+	if s.ChainStore == nil {
+		return nil, errors.New("no ChainStore provided to the storage service")
+	}
+	return s.ChainStore.List(after, limit)
+}
+
+// NewChain creates new chain with a genesis block and commits it to storage.
+// The chain uses the service's signature policy.
 func (s *Service) NewChain() (*Chain, error) {
 	hash, err := NewChainHash()
 	if err != nil {
 		return nil, err
 	}
-	c := &Chain{
-		Blocks:   make(map[Hash]Index),
-		Branches: make(map[BranchHash]*Branch),
-		Hash:     hash,
-	}
-	b := c.NewBlock(nil)
-	err = c.AddBlock(b)
+	c := s.newChain(hash)
+	_, err = s.NewBlock(c, nil)
 	if err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
+// NewEmptyChain creates a chain with the hash and no blocks, to be filled in with blocks from
+// elsewhere such as peers. It is not written to the chain store and has no owner, but
+// is validated with the service's signature policy and clock.
+func (s *Service) NewEmptyChain(hash ChainHash) *Chain {
+	c := s.newChain(hash)
+	c.Owner = ""
+	return c
+}
+
 // ReadChain reads a chain from the chain store using its hash.
 func (s *Service) ReadChain(hash ChainHash) (*Chain, error) {
 	if s.ChainStore == nil {
 		return nil, errors.New("no ChainStore provided to the storage service")
 	}
-	return s.ChainStore.Read(hash)
+	c, err := s.ChainStore.Read(hash)
+	if err != nil {
+		return nil, err
+	}
+	c.Clock = s.Clock
+	c.MaxClockSkew = s.MaxClockSkew
+	return c, nil
+}
+
+// now returns the current time from the service's clock.
+func (s *Service) now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+	return s.Clock.Now()
 }
 
 // WriteChain writes a chain to the chain store.
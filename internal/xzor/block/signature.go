@@ -0,0 +1,88 @@
+package block
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+)
+
+// SignaturePolicy determines whether a chain accepts unsigned blocks.
+// Signed blocks are always verified regardless of the policy.
+type SignaturePolicy int
+
+const (
+	// AllowUnsigned accepts blocks without a signature.
+	AllowUnsigned SignaturePolicy = iota
+
+	// RequireSigned rejects blocks without a signature.
+	RequireSigned
+)
+
+// Signer signs block headers on behalf of a local identity.
+type Signer interface {
+	PublicKey() []byte
+	Sign([]byte) ([]byte, error)
+}
+
+var _ Signer = &KeySigner{}
+
+// KeySigner implements Signer using an ed25519 private key.
+type KeySigner struct {
+	PrivateKey ed25519.PrivateKey
+}
+
+// NewKeySigner creates a signer with a newly generated key.
+func NewKeySigner() (*KeySigner, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySigner{
+		PrivateKey: key,
+	}, nil
+}
+
+// PublicKey returns the public key of the signer.
+func (s *KeySigner) PublicKey() []byte {
+	if len(s.PrivateKey) != ed25519.PrivateKeySize {
+		return nil
+	}
+	return []byte(s.PrivateKey.Public().(ed25519.PublicKey))
+}
+
+// Sign signs the provided data with the signer's private key.
+func (s *KeySigner) Sign(data []byte) ([]byte, error) {
+	if len(s.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid private key")
+	}
+	return ed25519.Sign(s.PrivateKey, data), nil
+}
+
+// Sign sets the block's author to the signer's public key and signs the block's header.
+func (b *Block) Sign(s Signer) error {
+	b.Author = s.PublicKey()
+	header, err := b.header()
+	if err != nil {
+		return err
+	}
+	sig, err := s.Sign(header)
+	if err != nil {
+		return err
+	}
+	b.Signature = sig
+	return nil
+}
+
+// Signed checks if the block claims an author or carries a signature.
+func (b *Block) Signed() bool {
+	return len(b.Author) > 0 || len(b.Signature) > 0
+}
+
+// VerifySignature checks the block's signature against its author's public key.
+func (b *Block) VerifySignature() error {
+	h, err := b.Header()
+	if err != nil {
+		return err
+	}
+	return h.verifySignature()
+}
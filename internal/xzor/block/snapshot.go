@@ -0,0 +1,112 @@
+package block
+
+import (
+	"errors"
+	"os"
+)
+
+// Mode determines whether a node keeps the full history of its chains.
+type Mode int
+
+const (
+	// Archival nodes keep every block of their chains.
+	Archival Mode = iota
+
+	// Pruned nodes remove blocks older than a chain's latest snapshot.
+	Pruned
+)
+
+// Snapshot captures the state derived from a chain at a block, along with the chain's head.
+type Snapshot struct {
+	Chain     ChainHash
+	Hash      Hash
+	Head      Hash
+	Index     Index
+	State     []byte
+	Timestamp int64
+}
+
+// SnapshotStore handles storage operations for the latest snapshot of each chain.
+type SnapshotStore interface {
+	Delete(ChainHash) error
+	Read(ChainHash) (*Snapshot, error)
+	Write(*Snapshot) error
+}
+
+// NewSnapshot captures the provided state at the chain's block with the given index
+// and writes it to the snapshot store. Nodes in pruned mode prune the chain afterwards.
+func (s *Service) NewSnapshot(c *Chain, index Index, state []byte) (*Snapshot, error) {
+	if s.SnapshotStore == nil {
+		return nil, errors.New("no SnapshotStore provided to the storage service")
+	}
+
+	c.mux.Lock()
+	var hash Hash
+	for h, i := range c.Blocks {
+		if i == index {
+			hash = h
+			break
+		}
+	}
+	snapshot := &Snapshot{
+		Chain:     c.Hash,
+		Hash:      hash,
+		Head:      c.LastHash,
+		Index:     index,
+		State:     state,
+		Timestamp: Timestamp(s.now()),
+	}
+	c.mux.Unlock()
+	if hash == "" {
+		return nil, ErrInvalidIndex
+	}
+
+	err := s.SnapshotStore.Write(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if s.Mode == Pruned {
+		err = s.Prune(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// Prune deletes the chain's blocks older than its latest snapshot from the block store.
+// The hashes of pruned blocks remain in the chain so it can still be verified.
+func (s *Service) Prune(c *Chain) error {
+	if s.Mode == Archival {
+		return ErrArchivalMode
+	}
+	snapshot, err := s.Snapshot(c.Hash)
+	if err != nil {
+		return err
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for hash, index := range c.Blocks {
+		if index < c.PrunedIndex || index >= snapshot.Index {
+			continue
+		}
+		err := s.BlockStore.Delete(hash)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if snapshot.Index > c.PrunedIndex {
+		c.PrunedIndex = snapshot.Index
+	}
+	return s.WriteChain(c)
+}
+
+// Snapshot reads the latest snapshot of a chain from the snapshot store.
+func (s *Service) Snapshot(hash ChainHash) (*Snapshot, error) {
+	if s.SnapshotStore == nil {
+		return nil, errors.New("no SnapshotStore provided to the storage service")
+	}
+	return s.SnapshotStore.Read(hash)
+}
@@ -0,0 +1,131 @@
+package common
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CacheStats counts the lookups and evictions of a cache.
+type CacheStats struct {
+	Evictions uint64
+	Hits      uint64
+	Misses    uint64
+}
+
+// LRU is a least recently used cache of values keyed by strings and safe for concurrent use.
+// Once it holds more than MaxEntries values, or the sizes of its values add up to more than
+// MaxSize, the least recently used values are evicted. Limits of zero or less are not enforced.
+// A nil LRU caches nothing, treating every lookup as a miss.
+type LRU struct {
+	MaxEntries int
+	MaxSize    int
+
+	entries map[string]*list.Element
+	mux     sync.Mutex
+	order   *list.List
+	size    int
+	stats   CacheStats
+}
+
+type lruEntry struct {
+	key   string
+	size  int
+	value interface{}
+}
+
+// Add caches a value with the given size, replacing any value already cached with the key.
+func (c *LRU) Add(key string, value interface{}, size int) {
+	if c == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.order = list.New()
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{
+		key:   key,
+		size:  size,
+		value: value,
+	})
+	c.size += size
+	for c.order.Len() > 0 && (c.MaxEntries > 0 && c.order.Len() > c.MaxEntries || c.MaxSize > 0 && c.size > c.MaxSize) {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Get returns the value cached with the key and marks it as recently used.
+func (c *LRU) Get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).value, true
+}
+
+// Len returns the number of cached values.
+func (c *LRU) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return len(c.entries)
+}
+
+// Remove evicts the value cached with the key, if any.
+func (c *LRU) Remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Size returns the total size of the cached values.
+func (c *LRU) Size() int {
+	if c == nil {
+		return 0
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.size
+}
+
+// Stats returns the cache's hit, miss and eviction counts.
+func (c *LRU) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.stats
+}
+
+func (c *LRU) remove(el *list.Element) {
+	e := c.order.Remove(el).(*lruEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
@@ -0,0 +1,117 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+)
+
+// KeySize is the length in bytes of the AES-256 keys used to seal data.
+const KeySize = 32
+
+// sealedMagic prefixes data sealed by Seal.
+var sealedMagic = []byte("XZEN")
+
+// sealedVersion is the current version of the sealed data format.
+const sealedVersion = 1
+
+// IsSealed reports whether data was sealed by Seal.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, sealedMagic)
+}
+
+// Open verifies and decrypts data sealed by Seal using the key named in its header.
+// The additional data must match the data provided when it was sealed.
+func Open(kr Keyring, data []byte, additionalData []byte) ([]byte, error) {
+	id, nonce, ciphertext, err := decodeSealed(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := kr.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// Seal encrypts and authenticates data with the keyring's active key and a random nonce.
+// The additional data, such as the ID the data is stored under, is authenticated but not stored,
+// so sealed data cannot be moved to another ID unnoticed.
+// Sealed data is formatted as [magic][version][uvarint-len key ID][nonce][ciphertext].
+func Seal(kr Keyring, data []byte, additionalData []byte) ([]byte, error) {
+	id, key, err := kr.ActiveKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := common.NewRandomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(sealedMagic)
+	buf.WriteByte(sealedVersion)
+	size := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(size, uint64(len(id)))
+	buf.Write(size[:n])
+	buf.WriteString(string(id))
+	buf.Write(nonce)
+	return aead.Seal(buf.Bytes(), nonce, data, additionalData), nil
+}
+
+// SealedKeyID returns the ID of the key that sealed the data.
+func SealedKeyID(data []byte) (KeyID, error) {
+	id, _, _, err := decodeSealed(data)
+	return id, err
+}
+
+func decodeSealed(data []byte) (KeyID, []byte, []byte, error) {
+	if !IsSealed(data) {
+		return "", nil, nil, ErrNotEncrypted
+	}
+	data = data[len(sealedMagic):]
+	if len(data) == 0 || data[0] != sealedVersion {
+		return "", nil, nil, errors.New("unsupported sealed data version")
+	}
+	data = data[1:]
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return "", nil, nil, errors.New("invalid sealed data")
+	}
+	data = data[n:]
+	id := KeyID(data[:size])
+	data = data[size:]
+
+	// Every key is an AES key using the standard GCM nonce size.
+	nonceSize := 12
+	if len(data) < nonceSize {
+		return "", nil, nil, errors.New("invalid sealed data")
+	}
+	return id, data[:nonceSize], data[nonceSize:], nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("invalid encryption key size")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
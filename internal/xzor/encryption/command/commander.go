@@ -0,0 +1,16 @@
+package command
+
+import (
+	"github.com/xzor-dev/xzor/internal/xzor/command"
+	"github.com/xzor-dev/xzor/internal/xzor/encryption"
+)
+
+// NewCommander creates a new Commander instance populated with commands managing the keyring of encrypted stores.
+func NewCommander(kr encryption.Rotator, stores []encryption.Reencrypter) *command.Commander {
+	return command.NewCommander([]command.Command{
+		&RotateKey{
+			Keyring: kr,
+			Stores:  stores,
+		},
+	})
+}
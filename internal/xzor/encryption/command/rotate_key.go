@@ -0,0 +1,32 @@
+package command
+
+import (
+	"github.com/xzor-dev/xzor/internal/xzor/command"
+	"github.com/xzor-dev/xzor/internal/xzor/encryption"
+)
+
+// RotateKeyName is the name of the RotateKey command.
+const RotateKeyName = "rotate-key"
+
+// RotateKey replaces the keyring's active key and re-encrypts the stores in the background.
+type RotateKey struct {
+	Keyring encryption.Rotator
+	Stores  []encryption.Reencrypter
+}
+
+// Execute rotates the key, responding with the rotation so callers can wait for the re-encryption to finish.
+func (c *RotateKey) Execute(args []interface{}) (*command.Response, error) {
+	rot, err := encryption.Rotate(c.Keyring, c.Stores)
+	if err != nil {
+		return nil, err
+	}
+	res := &command.Response{
+		Value: rot,
+	}
+	return res, nil
+}
+
+// Name returns the name of the command.
+func (c *RotateKey) Name() command.Name {
+	return RotateKeyName
+}
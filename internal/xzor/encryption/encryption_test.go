@@ -0,0 +1,138 @@
+package encryption_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/xzor-dev/xzor/internal/xzor/encryption"
+	"github.com/xzor-dev/xzor/internal/xzor/encryption/command"
+)
+
+func TestSeal(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	kr := &encryption.FileKeyring{
+		Dir: dir + "/testdata/keyring",
+	}
+	defer os.RemoveAll(dir + "/testdata")
+
+	sealed, err := encryption.Seal(kr, []byte("secret"), []byte("a"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Fatal("expected sealed data to be encrypted")
+	}
+	data, err := encryption.Open(kr, sealed, []byte("a"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(data) != "secret" {
+		t.Fatalf("unexpected opened data: %s", data)
+	}
+	_, err = encryption.Open(kr, sealed, []byte("b"))
+	if err == nil {
+		t.Fatal("expected data sealed for another ID to fail to open")
+	}
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = encryption.Open(kr, tampered, []byte("a"))
+	if err == nil {
+		t.Fatal("expected tampered data to fail to open")
+	}
+	_, err = encryption.Open(kr, []byte("plain"), nil)
+	if err != encryption.ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted, got %v", err)
+	}
+
+	// Keys are loaded from the keyring's directory, and rotated keys still open older data.
+	first, err := encryption.SealedKeyID(sealed)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	info, err := os.Stat(kr.Dir + "/" + string(first) + ".key")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected key file permissions: %v", info.Mode().Perm())
+	}
+	reloaded := &encryption.FileKeyring{
+		Dir: kr.Dir,
+	}
+	second, err := reloaded.Rotate()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	active, _, err := reloaded.ActiveKey()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if second == first || active != second {
+		t.Fatal("expected the rotated key to become the active key")
+	}
+	active, _, err = (&encryption.FileKeyring{Dir: kr.Dir}).ActiveKey()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if active != second {
+		t.Fatal("expected the rotated key to be stored as the active key")
+	}
+	_, err = encryption.Open(reloaded, sealed, []byte("a"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = reloaded.Key("missing")
+	if err != encryption.ErrUnknownKey {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestRotateKeyCommand(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	kr := &encryption.FileKeyring{
+		Dir: dir + "/testdata/rotation",
+	}
+	defer os.RemoveAll(dir + "/testdata")
+
+	stores := []encryption.Reencrypter{
+		&testStore{count: 2},
+		&testStore{count: 3},
+	}
+	commander := command.NewCommander(kr, stores)
+	res, err := commander.Execute(command.RotateKeyName, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	rot := res.Value.(*encryption.Rotation)
+	n, err := rot.Wait()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if n != 5 {
+		t.Fatalf("expected every store to be re-encrypted, got %d items", n)
+	}
+	active, _, err := kr.ActiveKey()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if active != rot.KeyID {
+		t.Fatal("expected the rotation to report the new active key")
+	}
+}
+
+var _ encryption.Reencrypter = &testStore{}
+
+type testStore struct {
+	count int
+}
+
+func (s *testStore) Reencrypt() (int, error) {
+	return s.count, nil
+}
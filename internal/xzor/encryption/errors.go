@@ -0,0 +1,9 @@
+package encryption
+
+import "errors"
+
+// ErrNotEncrypted occurs when opening data that was not sealed.
+var ErrNotEncrypted = errors.New("data is not encrypted")
+
+// ErrUnknownKey occurs when data was sealed with a key missing from the keyring.
+var ErrUnknownKey = errors.New("unknown encryption key")
@@ -0,0 +1,147 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+)
+
+const (
+	activeKeyFile = "active"
+	keyExt        = ".key"
+)
+
+// Keyring provides the keys used to seal and open data.
+// New data is sealed with the active key, while data sealed with older keys can still be opened.
+type Keyring interface {
+	ActiveKey() (KeyID, []byte, error)
+	Key(KeyID) ([]byte, error)
+}
+
+// Rotator is implemented by keyrings that can replace their active key.
+type Rotator interface {
+	Rotate() (KeyID, error)
+}
+
+// KeyID identifies a key within a keyring.
+type KeyID string
+
+var _ Keyring = &FileKeyring{}
+var _ Rotator = &FileKeyring{}
+
+// FileKeyring stores hex encoded keys in files readable only by their owner, within Dir.
+// A key is generated the first time the active key is requested from an empty keyring.
+// The active key is cached once read, so Dir should only be rotated through a single FileKeyring.
+type FileKeyring struct {
+	Dir string
+
+	active KeyID
+	keys   map[KeyID][]byte
+	mux    sync.Mutex
+}
+
+// ActiveKey returns the key new data is sealed with.
+func (k *FileKeyring) ActiveKey() (KeyID, []byte, error) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+
+	if k.active != "" {
+		key, err := k.key(k.active)
+		return k.active, key, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(k.Dir, activeKeyFile))
+	if os.IsNotExist(err) {
+		id, err := k.rotate()
+		if err != nil {
+			return "", nil, err
+		}
+		key, err := k.key(id)
+		return id, key, err
+	} else if err != nil {
+		return "", nil, err
+	}
+	id := KeyID(strings.TrimSpace(string(data)))
+	key, err := k.key(id)
+	if err != nil {
+		return "", nil, err
+	}
+	k.active = id
+	return id, key, nil
+}
+
+// Key returns a key by its ID.
+func (k *FileKeyring) Key(id KeyID) ([]byte, error) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+
+	return k.key(id)
+}
+
+// Rotate generates a new key and makes it the active key.
+func (k *FileKeyring) Rotate() (KeyID, error) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+
+	return k.rotate()
+}
+
+func (k *FileKeyring) key(id KeyID) ([]byte, error) {
+	if key, ok := k.keys[id]; ok {
+		return key, nil
+	}
+	if id == "" || strings.ContainsAny(string(id), `/\.`) {
+		return nil, ErrUnknownKey
+	}
+	data, err := ioutil.ReadFile(filepath.Join(k.Dir, string(id)+keyExt))
+	if os.IsNotExist(err) {
+		return nil, ErrUnknownKey
+	} else if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	if k.keys == nil {
+		k.keys = make(map[KeyID][]byte)
+	}
+	k.keys[id] = key
+	return key, nil
+}
+
+func (k *FileKeyring) rotate() (KeyID, error) {
+	err := os.MkdirAll(k.Dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	rb, err := common.NewRandomBytes(8)
+	if err != nil {
+		return "", err
+	}
+	id := KeyID(hex.EncodeToString(rb))
+	key, err := common.NewRandomBytes(KeySize)
+	if err != nil {
+		return "", err
+	}
+	// Both files are written atomically and synced, so the active key is never read
+	// half written and never refers to a key lost in a crash.
+	err = common.WriteFile(filepath.Join(k.Dir, string(id)+keyExt), []byte(hex.EncodeToString(key)), 0600)
+	if err != nil {
+		return "", err
+	}
+	err = common.WriteFile(filepath.Join(k.Dir, activeKeyFile), []byte(id), 0600)
+	if err != nil {
+		return "", err
+	}
+	if k.keys == nil {
+		k.keys = make(map[KeyID][]byte)
+	}
+	k.keys[id] = key
+	k.active = id
+	return id, nil
+}
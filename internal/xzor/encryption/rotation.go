@@ -0,0 +1,53 @@
+package encryption
+
+// Reencrypter is implemented by stores that can reseal their data with the keyring's active key,
+// returning the number of items resealed.
+type Reencrypter interface {
+	Reencrypt() (int, error)
+}
+
+// Rotation tracks the re-encryption of stores after their keyring's active key was replaced.
+type Rotation struct {
+	KeyID KeyID
+
+	count int
+	done  chan struct{}
+	err   error
+}
+
+// Rotate replaces the keyring's active key and re-encrypts the stores one after another in the background.
+// Data sealed with older keys remains readable while the rotation runs, so old keys must be kept until it is done.
+func Rotate(r Rotator, stores []Reencrypter) (*Rotation, error) {
+	id, err := r.Rotate()
+	if err != nil {
+		return nil, err
+	}
+	rot := &Rotation{
+		KeyID: id,
+		done:  make(chan struct{}),
+	}
+	go func() {
+		defer close(rot.done)
+		for _, s := range stores {
+			n, err := s.Reencrypt()
+			rot.count += n
+			if err != nil {
+				rot.err = err
+				return
+			}
+		}
+	}()
+	return rot, nil
+}
+
+// Done returns a channel closed once every store has been re-encrypted or one has failed.
+func (r *Rotation) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait blocks until the rotation is done and returns the number of items resealed,
+// along with the error that stopped it, if any.
+func (r *Rotation) Wait() (int, error) {
+	<-r.done
+	return r.count, r.err
+}
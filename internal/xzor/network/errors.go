@@ -0,0 +1,6 @@
+package network
+
+import "errors"
+
+// ErrNoRelay is returned by a DataHandler to indicate that handled data should not be relayed to other nodes.
+var ErrNoRelay = errors.New("data should not be relayed")
@@ -39,7 +39,7 @@ func TestNetwork(t *testing.T) {
 
 	go func() {
 		err := <-nodeA.Errors
-		t.Fatalf("%v", err)
+		t.Errorf("%v", err)
 	}()
 
 	msg := "hello"
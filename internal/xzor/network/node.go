@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -17,6 +18,7 @@ type Node struct {
 	connections         []Connection
 	inboundConnections  []net.Conn
 	listeners           []Listener
+	mux                 sync.Mutex
 	outboundConnections []net.Conn
 	quit                chan bool
 }
@@ -60,34 +62,49 @@ func (n *Node) handleData(data []byte) {
 	}
 
 	err := n.DataHandler.HandleData(data)
+	if err == ErrNoRelay {
+		return
+	}
 	if err != nil {
 		log.Printf("failed to handle data: %v", err)
 		n.Errors <- err
 		return
 	}
 
+	n.mux.Lock()
+	defer n.mux.Unlock()
 	for _, conn := range n.outboundConnections {
 		go conn.Write(data)
 	}
 }
 
-func (n *Node) handleInboundConnection(conn net.Conn) {
-	n.inboundConnections = append(n.inboundConnections, conn)
-	buffer := bufio.NewReader(conn)
-	for {
-		log.Println("reading data from inbound connection")
-		data, err := buffer.ReadBytes('\n')
-		if err == io.EOF {
-			log.Printf("closing connection")
-			conn.Close()
-			return
+// Send writes data to every inbound and outbound connection as a single newline-terminated message.
+func (n *Node) Send(data []byte) error {
+	msg := append(append([]byte{}, data...), '\n')
+
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	for _, conns := range [][]net.Conn{n.inboundConnections, n.outboundConnections} {
+		for _, conn := range conns {
+			_, err := conn.Write(msg)
+			if err != nil {
+				return err
+			}
 		}
-		if err != nil {
-			log.Printf("connection error: %v", err)
-			return
-		}
-		n.handleData(data[:len(data)-1])
 	}
+	return nil
+}
+
+func (n *Node) handleInboundConnection(conn net.Conn) {
+	n.mux.Lock()
+	n.inboundConnections = append(n.inboundConnections, conn)
+	n.mux.Unlock()
+
+	n.readConnection(conn)
+
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.inboundConnections = removeConnection(n.inboundConnections, conn)
 }
 
 func (n *Node) handleListener(l net.Listener) {
@@ -102,8 +119,15 @@ func (n *Node) handleListener(l net.Listener) {
 }
 
 func (n *Node) handleOutboundConnection(conn net.Conn) {
+	n.mux.Lock()
 	n.outboundConnections = append(n.outboundConnections, conn)
-	//...
+	n.mux.Unlock()
+
+	n.readConnection(conn)
+
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.outboundConnections = removeConnection(n.outboundConnections, conn)
 }
 
 func (n *Node) initConnection(c Connection) {
@@ -141,3 +165,32 @@ func (n *Node) initListeners() {
 		go n.initListener(l)
 	}
 }
+
+// readConnection handles newline-terminated messages from a connection until it is closed.
+func (n *Node) readConnection(conn net.Conn) {
+	buffer := bufio.NewReader(conn)
+	for {
+		log.Println("reading data from connection")
+		data, err := buffer.ReadBytes('\n')
+		if err == io.EOF {
+			log.Printf("closing connection")
+			conn.Close()
+			return
+		}
+		if err != nil {
+			log.Printf("connection error: %v", err)
+			return
+		}
+		n.handleData(data[:len(data)-1])
+	}
+}
+
+// removeConnection returns the connections without conn.
+func removeConnection(conns []net.Conn, conn net.Conn) []net.Conn {
+	for i, c := range conns {
+		if c == conn {
+			return append(conns[:i], conns[i+1:]...)
+		}
+	}
+	return conns
+}
@@ -0,0 +1,100 @@
+package storage
+
+import "fmt"
+
+// Batch collects record writes and deletes that are committed together.
+type Batch struct {
+	Ops []*BatchOp
+}
+
+// Delete adds the deletion of a record to the batch.
+func (b *Batch) Delete(id RecordID) {
+	b.Ops = append(b.Ops, &BatchOp{
+		Delete: true,
+		ID:     id,
+	})
+}
+
+// Write adds a record's encoded data to the batch.
+func (b *Batch) Write(id RecordID, data []byte) {
+	b.Ops = append(b.Ops, &BatchOp{
+		Data: data,
+		ID:   id,
+	})
+}
+
+// BatchOp is a single write or delete within a batch.
+type BatchOp struct {
+	Data   []byte
+	Delete bool
+	ID     RecordID
+}
+
+// BatchStore is implemented by record stores that can commit a batch atomically,
+// applying either all of its operations or none of them.
+// A NotAppliedError is returned for batches that were committed but could not be applied yet.
+type BatchStore interface {
+	CommitBatch(*Batch) error
+}
+
+// NotAppliedError occurs when a batch was durably committed but applying it failed.
+// The batch must not be committed again, as the store completes it when it recovers.
+type NotAppliedError struct {
+	Err error
+}
+
+func (e *NotAppliedError) Error() string {
+	return fmt.Sprintf("batch committed but not applied: %v", e.Err)
+}
+
+// Is reports whether the target is ErrNotApplied, allowing errors.Is to match any NotAppliedError.
+func (e *NotAppliedError) Is(target error) bool {
+	return target == ErrNotApplied
+}
+
+// Unwrap returns the error that prevented the batch from being applied.
+func (e *NotAppliedError) Unwrap() error {
+	return e.Err
+}
+
+// Tx is a transaction collecting record writes and deletes to be committed as a batch.
+// Reads within a transaction see the records already committed to the store,
+// and the transaction only commits if none of them have changed since.
+type Tx struct {
+	batch   *Batch
+	headers []*recordHeader
+	reads   map[RecordID]Revision
+	records []interface{}
+	service *Service
+}
+
+// Delete removes a record when the transaction commits.
+func (tx *Tx) Delete(id RecordID) {
+	tx.batch.Delete(id)
+	tx.headers = append(tx.headers, nil)
+	tx.records = append(tx.records, nil)
+}
+
+// Read gets a committed record and decodes it into the provided record.
+func (tx *Tx) Read(id RecordID, record interface{}) error {
+	rev, err := tx.service.ReadRevision(id, record)
+	if err != nil {
+		return err
+	}
+	if _, ok := tx.reads[id]; !ok {
+		tx.reads[id] = rev
+	}
+	return nil
+}
+
+// Write encodes a record to be written when the transaction commits.
+func (tx *Tx) Write(id RecordID, record interface{}) error {
+	h, data, err := tx.service.encode(record)
+	if err != nil {
+		return err
+	}
+	tx.batch.Write(id, data)
+	tx.headers = append(tx.headers, h)
+	tx.records = append(tx.records, record)
+	return nil
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+	"github.com/xzor-dev/xzor/internal/xzor/storage"
+)
+
+var _ storage.RecordStore = &RecordStore{}
+var _ storage.BatchStore = &RecordStore{}
+
+// RecordStore is a read-through cache in front of another record store.
+// Records read from Store are kept in Cache, sized by the length of their data,
+// and writes go through to Store before updating the cache. Records changed
+// in Store without going through the cache are not seen until they are evicted.
+// A nil Cache disables caching.
+type RecordStore struct {
+	Cache *common.LRU
+	Store storage.RecordStore
+
+	mux sync.RWMutex
+}
+
+// CommitBatch commits the batch to Store and drops its records from the cache.
+// It returns storage.ErrNoTransactions when Store does not implement storage.BatchStore.
+func (s *RecordStore) CommitBatch(b *storage.Batch) error {
+	bs, ok := s.Store.(storage.BatchStore)
+	if !ok {
+		return storage.ErrNoTransactions
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, op := range b.Ops {
+		s.Cache.Remove(string(op.ID))
+	}
+	return bs.CommitBatch(b)
+}
+
+// Delete removes a record from Store and the cache.
+func (s *RecordStore) Delete(id storage.RecordID) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.Cache.Remove(string(id))
+	return s.Store.Delete(id)
+}
+
+// List returns the IDs of the records in Store matching the options.
+func (s *RecordStore) List(opts *storage.ListOptions) ([]storage.RecordID, error) {
+	return s.Store.List(opts)
+}
+
+// Read returns a record's data from the cache, reading it from Store when it is not cached.
+func (s *RecordStore) Read(id storage.RecordID) ([]byte, error) {
+	if cached, ok := s.Cache.Get(string(id)); ok {
+		return copyData(cached.([]byte)), nil
+	}
+
+	// Reads hold the lock while filling the cache so data read before a write
+	// cannot replace the written data in the cache.
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	data, err := s.Store.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	s.Cache.Add(string(id), copyData(data), len(data))
+	return data, nil
+}
+
+// Stats returns the cache's hit, miss and eviction counts.
+func (s *RecordStore) Stats() common.CacheStats {
+	return s.Cache.Stats()
+}
+
+// Write writes a record's data to Store and caches it.
+func (s *RecordStore) Write(id storage.RecordID, data []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.Cache.Remove(string(id))
+	err := s.Store.Write(id, data)
+	if err != nil {
+		return err
+	}
+	s.Cache.Add(string(id), copyData(data), len(data))
+	return nil
+}
+
+func copyData(data []byte) []byte {
+	c := make([]byte, len(data))
+	copy(c, data)
+	return c
+}
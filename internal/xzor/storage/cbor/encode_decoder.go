@@ -0,0 +1,31 @@
+package cbor
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/xzor-dev/xzor/internal/xzor/storage"
+)
+
+var _ storage.RecordEncodeDecoder = &EncodeDecoder{}
+var _ storage.EncodingIdentifier = &EncodeDecoder{}
+
+// encMode encodes records deterministically, so equal records always produce equal bytes.
+var encMode, _ = cbor.CoreDetEncOptions().EncMode()
+
+// EncodeDecoder provides methods to encode and decode records into and from CBOR.
+// Unlike JSON, CBOR keeps byte strings and integers distinct from text and floating point numbers.
+type EncodeDecoder struct{}
+
+// DecodeRecord converts CBOR data into the supplied record interface.
+func (ed *EncodeDecoder) DecodeRecord(data []byte, record interface{}) error {
+	return cbor.Unmarshal(data, record)
+}
+
+// Encoding returns the ID stored in the header of records encoded as CBOR.
+func (ed *EncodeDecoder) Encoding() string {
+	return "cbor"
+}
+
+// EncodeRecord converts a record interface into CBOR data.
+func (ed *EncodeDecoder) EncodeRecord(record interface{}) ([]byte, error) {
+	return encMode.Marshal(record)
+}
@@ -0,0 +1,7 @@
+package chain
+
+import "errors"
+
+// ErrChainPruned occurs when a record store's chain has been pruned, since the history
+// of its records can no longer be replayed.
+var ErrChainPruned = errors.New("record chain has been pruned")
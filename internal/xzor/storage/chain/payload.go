@@ -0,0 +1,55 @@
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/storage"
+)
+
+// PayloadType identifies record changes stored in blocks.
+const PayloadType block.PayloadType = "xzor.storage.batch"
+
+// PayloadVersion is the current schema version of record change payloads.
+const PayloadVersion uint64 = 1
+
+var _ block.PayloadDecoder = &PayloadDecoder{}
+
+// PayloadDecoder decodes the batches of record changes stored in block payloads.
+type PayloadDecoder struct{}
+
+// DecodePayload converts a record change payload back into a batch.
+func (d *PayloadDecoder) DecodePayload(p *block.Payload) (interface{}, error) {
+	if p.Type != PayloadType {
+		return nil, block.ErrUnknownPayload
+	}
+	if p.Version != PayloadVersion || p.Encoding != block.EncodingJSON {
+		return nil, errors.New("unsupported record change payload")
+	}
+	b := &storage.Batch{}
+	err := json.Unmarshal(p.Data, b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewPayload wraps a batch of record changes in a block payload.
+func NewPayload(b *storage.Batch) (*block.Payload, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return &block.Payload{
+		Data:     data,
+		Encoding: block.EncodingJSON,
+		Type:     PayloadType,
+		Version:  PayloadVersion,
+	}, nil
+}
+
+// RegisterPayload registers the record change payload decoder with a payload registry.
+func RegisterPayload(r *block.PayloadRegistry) error {
+	return r.Register(PayloadType, &PayloadDecoder{})
+}
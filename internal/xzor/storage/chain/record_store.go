@@ -0,0 +1,357 @@
+package chain
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	"github.com/xzor-dev/xzor/internal/xzor/storage"
+	"github.com/xzor-dev/xzor/internal/xzor/storage/memory"
+)
+
+var _ storage.RecordStore = &RecordStore{}
+var _ storage.BatchStore = &RecordStore{}
+
+// RecordStore records every write and delete as a block appended to a chain, giving records
+// a tamper evident history. Each batch is stored in a single block, so batches are committed atomically.
+//
+// The current records are materialized in View, which defaults to memory, and the blocks holding
+// every version of each record are kept in memory, while the data of past versions is read from
+// the chain when requested. Both are rebuilt by replaying the chain when the store is first used,
+// so the chain must not be pruned, and it must only be appended to through this store.
+// The store needs exclusive use of View: records in View without a history in the chain are deleted.
+type RecordStore struct {
+	Chain   block.ChainHash
+	Manager *block.Manager
+	View    storage.RecordStore
+
+	history map[storage.RecordID][]*version
+	loaded  bool
+	mux     sync.RWMutex
+}
+
+// Version is a record's data as written, or deleted, by a block of the chain.
+type Version struct {
+	Block   block.Hash
+	Data    []byte
+	Deleted bool
+	Index   block.Index
+}
+
+// version locates a record's version within the chain.
+type version struct {
+	block   block.Hash
+	deleted bool
+	index   block.Index
+}
+
+// CommitBatch appends the batch to the chain as a single block and applies it to the view.
+func (s *RecordStore) CommitBatch(b *storage.Batch) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	err := s.load()
+	if err != nil {
+		return err
+	}
+	return s.commit(b)
+}
+
+// Delete appends the deletion of a record to the chain.
+// Deleting a record that does not exist appends nothing.
+func (s *RecordStore) Delete(id storage.RecordID) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	err := s.load()
+	if err != nil {
+		return err
+	}
+	if v := s.latest(id); v == nil || v.deleted {
+		return nil
+	}
+	b := &storage.Batch{}
+	b.Delete(id)
+	return s.commit(b)
+}
+
+// History returns every version of a record, ordered by the index of the block that created it.
+// The data of each version is read from its block.
+func (s *RecordStore) History(id storage.RecordID) ([]*Version, error) {
+	err := s.ensureLoaded()
+	if err != nil {
+		return nil, err
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	versions := make([]*Version, len(s.history[id]))
+	for i, v := range s.history[id] {
+		versions[i] = &Version{
+			Block:   v.block,
+			Deleted: v.deleted,
+			Index:   v.index,
+		}
+		if v.deleted {
+			continue
+		}
+		versions[i].Data, err = s.versionData(id, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+// List returns the IDs of the current records matching the options.
+func (s *RecordStore) List(opts *storage.ListOptions) ([]storage.RecordID, error) {
+	err := s.ensureLoaded()
+	if err != nil {
+		return nil, err
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.View.List(opts)
+}
+
+// Read returns a record's current data from the view.
+func (s *RecordStore) Read(id storage.RecordID) ([]byte, error) {
+	err := s.ensureLoaded()
+	if err != nil {
+		return nil, err
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.View.Read(id)
+}
+
+// ReadAt returns a record's data as it was once the block at the index was added to the chain.
+// ErrRecordNotFound is returned if the record did not exist at that point.
+func (s *RecordStore) ReadAt(id storage.RecordID, index block.Index) ([]byte, error) {
+	err := s.ensureLoaded()
+	if err != nil {
+		return nil, err
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	versions := s.history[id]
+	i := sort.Search(len(versions), func(i int) bool {
+		return versions[i].index > index
+	})
+	if i == 0 || versions[i-1].deleted {
+		return nil, storage.ErrRecordNotFound
+	}
+	return s.versionData(id, versions[i-1])
+}
+
+// Write appends a record's data to the chain.
+func (s *RecordStore) Write(id storage.RecordID, data []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	err := s.load()
+	if err != nil {
+		return err
+	}
+	b := &storage.Batch{}
+	b.Write(id, data)
+	return s.commit(b)
+}
+
+// apply adds the changes of a batch stored in a block to the history.
+func (s *RecordStore) apply(blk *block.Block, b *storage.Batch) {
+	if s.history == nil {
+		s.history = make(map[storage.RecordID][]*version)
+	}
+	for _, op := range b.Ops {
+		v := &version{
+			block:   blk.Hash,
+			deleted: op.Delete,
+			index:   blk.Index,
+		}
+		// A record changed more than once in a batch has a single version, its last change.
+		if versions := s.history[op.ID]; len(versions) > 0 && versions[len(versions)-1].block == blk.Hash {
+			versions[len(versions)-1] = v
+			continue
+		}
+		s.history[op.ID] = append(s.history[op.ID], v)
+	}
+}
+
+// commit appends a batch to the chain and applies it to the history and view.
+// Once the block is appended the batch is committed: if the view cannot be updated, a
+// storage.NotAppliedError is returned and the view is rebuilt the next time the store is used.
+func (s *RecordStore) commit(b *storage.Batch) error {
+	p, err := NewPayload(b)
+	if err != nil {
+		return err
+	}
+	data, err := block.EncodePayload(p)
+	if err != nil {
+		return err
+	}
+	blk, err := s.Manager.Append(s.Chain, data)
+	if err != nil {
+		return err
+	}
+	s.apply(blk, b)
+
+	if bs, ok := s.View.(storage.BatchStore); ok {
+		err = bs.CommitBatch(b)
+	} else {
+		for _, op := range b.Ops {
+			if op.Delete {
+				err = s.View.Delete(op.ID)
+			} else {
+				err = s.View.Write(op.ID, op.Data)
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		s.loaded = false
+		return &storage.NotAppliedError{Err: err}
+	}
+	return nil
+}
+
+// ensureLoaded replays the chain if it has not been loaded yet.
+func (s *RecordStore) ensureLoaded() error {
+	s.mux.RLock()
+	loaded := s.loaded
+	s.mux.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.load()
+}
+
+// latest returns the most recent version of a record, or nil if it was never written.
+func (s *RecordStore) latest(id storage.RecordID) *version {
+	versions := s.history[id]
+	if len(versions) == 0 {
+		return nil
+	}
+	return versions[len(versions)-1]
+}
+
+// load replays the chain's record changes into the history and brings the view up to date,
+// deleting records the chain has no history of. Blocks holding other payloads are skipped.
+// ErrChainPruned is returned if blocks of the chain have been pruned.
+func (s *RecordStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	if s.View == nil {
+		s.View = &memory.RecordStore{}
+	}
+	c, err := s.Manager.Chain(s.Chain)
+	if err != nil {
+		return err
+	}
+	if c.PrunedIndex > 0 {
+		return ErrChainPruned
+	}
+	s.history = nil
+	current := make(map[storage.RecordID][]byte)
+	for _, hash := range c.Hashes() {
+		blk, b, err := s.readBatch(hash)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			continue
+		}
+		s.apply(blk, b)
+		for _, op := range b.Ops {
+			if op.Delete {
+				delete(current, op.ID)
+			} else {
+				current[op.ID] = op.Data
+			}
+		}
+	}
+
+	ids, err := s.View.List(nil)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, ok := current[id]; !ok {
+			err := s.View.Delete(id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for id, data := range current {
+		stored, err := s.View.Read(id)
+		if err == nil && bytes.Equal(stored, data) {
+			continue
+		} else if err != nil && err != storage.ErrRecordNotFound {
+			return err
+		}
+		err = s.View.Write(id, data)
+		if err != nil {
+			return err
+		}
+	}
+	s.loaded = true
+	return nil
+}
+
+// readBatch reads a block and decodes the batch of record changes it holds.
+// The batch is nil for blocks holding other payloads.
+func (s *RecordStore) readBatch(hash block.Hash) (*block.Block, *storage.Batch, error) {
+	blk, err := s.Manager.Service.ReadBlock(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := blk.Payload()
+	if err == block.ErrUntypedPayload {
+		return blk, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if p.Type != PayloadType {
+		return blk, nil, nil
+	}
+	b, err := (&PayloadDecoder{}).DecodePayload(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return blk, b.(*storage.Batch), nil
+}
+
+// versionData reads the data a version of a record was written with from its block.
+func (s *RecordStore) versionData(id storage.RecordID, v *version) ([]byte, error) {
+	_, b, err := s.readBatch(v.block)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	found := false
+	if b != nil {
+		for _, op := range b.Ops {
+			if op.ID == id && !op.Delete {
+				data = op.Data
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("block %s does not hold record %s", v.block, id)
+	}
+	return data, nil
+}
@@ -0,0 +1,143 @@
+package encrypted
+
+import (
+	"sync"
+
+	"github.com/xzor-dev/xzor/internal/xzor/encryption"
+	"github.com/xzor-dev/xzor/internal/xzor/storage"
+)
+
+var _ storage.RecordStore = &RecordStore{}
+var _ storage.BatchStore = &RecordStore{}
+var _ encryption.Reencrypter = &RecordStore{}
+
+// RecordStore encrypts record data before it reaches another record store.
+// Data is sealed with the keyring's active key, authenticated along with the record's ID.
+// Stores holding records written before encryption was enabled can set AllowPlaintext
+// to read them until they are sealed by Reencrypt.
+type RecordStore struct {
+	AllowPlaintext bool
+	Keyring        encryption.Keyring
+	Store          storage.RecordStore
+
+	mux sync.Mutex
+}
+
+// CommitBatch seals the data of the batch's writes and commits it to Store.
+// It returns storage.ErrNoTransactions when Store does not implement storage.BatchStore.
+func (s *RecordStore) CommitBatch(b *storage.Batch) error {
+	bs, ok := s.Store.(storage.BatchStore)
+	if !ok {
+		return storage.ErrNoTransactions
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	sealed := &storage.Batch{}
+	for _, op := range b.Ops {
+		if op.Delete {
+			sealed.Delete(op.ID)
+			continue
+		}
+		data, err := encryption.Seal(s.Keyring, op.Data, []byte(op.ID))
+		if err != nil {
+			return err
+		}
+		sealed.Write(op.ID, data)
+	}
+	return bs.CommitBatch(sealed)
+}
+
+// Delete removes a record from Store.
+func (s *RecordStore) Delete(id storage.RecordID) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.Store.Delete(id)
+}
+
+// List returns the IDs of the records in Store matching the options.
+func (s *RecordStore) List(opts *storage.ListOptions) ([]storage.RecordID, error) {
+	return s.Store.List(opts)
+}
+
+// Read gets a record's sealed data from Store and opens it.
+func (s *RecordStore) Read(id storage.RecordID) ([]byte, error) {
+	data, err := s.Store.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(id, data)
+}
+
+// Reencrypt seals every record that was not sealed with the keyring's active key, returning the number resealed.
+// Records are sealed with the key active when they are written, so writes made during
+// a rotation never need resealing.
+// The index entries a storage.Service keeps in Store are sealed like any other record,
+// so they are resealed too rather than being left on a retired key.
+func (s *RecordStore) Reencrypt() (int, error) {
+	ids, err := s.Store.List(nil)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, id := range ids {
+		resealed, err := s.reencrypt(id)
+		if err != nil {
+			return count, err
+		}
+		if resealed {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Write seals a record's data and writes it to Store.
+func (s *RecordStore) Write(id storage.RecordID, data []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	sealed, err := encryption.Seal(s.Keyring, data, []byte(id))
+	if err != nil {
+		return err
+	}
+	return s.Store.Write(id, sealed)
+}
+
+func (s *RecordStore) open(id storage.RecordID, data []byte) ([]byte, error) {
+	if s.AllowPlaintext && !encryption.IsSealed(data) {
+		return data, nil
+	}
+	return encryption.Open(s.Keyring, data, []byte(id))
+}
+
+// reencrypt reseals a record with the active key. Writes are held off meanwhile so
+// a record written during the rotation is not replaced by its older data.
+func (s *RecordStore) reencrypt(id storage.RecordID) (bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	active, _, err := s.Keyring.ActiveKey()
+	if err != nil {
+		return false, err
+	}
+	data, err := s.Store.Read(id)
+	if err == storage.ErrRecordNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if keyID, err := encryption.SealedKeyID(data); err == nil && keyID == active {
+		return false, nil
+	}
+	data, err = s.open(id, data)
+	if err != nil {
+		return false, err
+	}
+	sealed, err := encryption.Seal(s.Keyring, data, []byte(id))
+	if err != nil {
+		return false, err
+	}
+	return true, s.Store.Write(id, sealed)
+}
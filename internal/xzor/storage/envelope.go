@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// Versions of the header written before every record's encoded data.
+// Version 1 headers hold only the record's revision as an 8-byte big-endian integer.
+// Version 2 headers follow the revision with the record's encoding ID and type as
+// length-prefixed strings, then its schema version as a uvarint.
+const (
+	headerV1 byte = 1
+	headerV2 byte = 2
+)
+
+const revisionSize = 8
+
+// EncodingIdentifier is implemented by encode decoders to name the encoding
+// they produce, so records can be decoded after the service switches encoders.
+type EncodingIdentifier interface {
+	Encoding() string
+}
+
+// MigrationFunc upgrades a record's encoded data from one schema version to the next,
+// returning the data in the new schema using the same encoding.
+type MigrationFunc func(data []byte, ed RecordEncodeDecoder) ([]byte, error)
+
+// Migrations holds the functions upgrading each record type between schema versions.
+type Migrations struct {
+	migrations map[string]map[uint64]MigrationFunc
+	mux        sync.RWMutex
+}
+
+// Register adds a migration upgrading records of a type from a schema version to the next version.
+func (m *Migrations) Register(recordType string, from uint64, fn MigrationFunc) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.migrations == nil {
+		m.migrations = make(map[string]map[uint64]MigrationFunc)
+	}
+	if m.migrations[recordType] == nil {
+		m.migrations[recordType] = make(map[uint64]MigrationFunc)
+	}
+	if m.migrations[recordType][from] != nil {
+		return errors.New("a migration is already registered for the record type and schema version")
+	}
+	m.migrations[recordType][from] = fn
+	return nil
+}
+
+// migrate upgrades a record's data through each schema version until it reaches the target version.
+func (m *Migrations) migrate(recordType string, from uint64, to uint64, data []byte, ed RecordEncodeDecoder) ([]byte, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	for v := from; v < to; v++ {
+		fn := m.migrations[recordType][v]
+		if fn == nil {
+			return nil, ErrNoMigration
+		}
+		var err error
+		data, err = fn(data, ed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// VersionedRecord is implemented by records that declare their type and schema version.
+// Both are stored in the record's header, allowing older records to be migrated when read.
+type VersionedRecord interface {
+	RecordType() string
+	SchemaVersion() uint64
+}
+
+// recordHeader describes the encoded data stored after it.
+// Records written before headers were introduced have an empty header.
+type recordHeader struct {
+	Encoding      string
+	Revision      Revision
+	SchemaVersion uint64
+	Type          string
+}
+
+// decodeHeader splits stored data into its header and encoded record.
+func decodeHeader(data []byte) (*recordHeader, []byte, error) {
+	h := &recordHeader{}
+	if len(data) < 1+revisionSize || data[0] != headerV1 && data[0] != headerV2 {
+		return h, data, nil
+	}
+	version := data[0]
+	h.Revision = Revision(binary.BigEndian.Uint64(data[1 : 1+revisionSize]))
+	data = data[1+revisionSize:]
+	if version == headerV1 {
+		return h, data, nil
+	}
+
+	var err error
+	h.Encoding, data, err = decodeHeaderString(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	h.Type, data, err = decodeHeaderString(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	schemaVersion, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, nil, errors.New("invalid record header")
+	}
+	h.SchemaVersion = schemaVersion
+	return h, data[n:], nil
+}
+
+func decodeHeaderString(data []byte) (string, []byte, error) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return "", nil, errors.New("invalid record header")
+	}
+	data = data[n:]
+	return string(data[:size]), data[size:], nil
+}
+
+// encodeHeader prefixes a record's encoded data with its header.
+func encodeHeader(h *recordHeader, payload []byte) []byte {
+	data := make([]byte, 1+revisionSize, 1+revisionSize+3*binary.MaxVarintLen64+len(h.Encoding)+len(h.Type)+len(payload))
+	data[0] = headerV2
+	binary.BigEndian.PutUint64(data[1:], uint64(h.Revision))
+	size := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(size, uint64(len(h.Encoding)))
+	data = append(data, size[:n]...)
+	data = append(data, h.Encoding...)
+	n = binary.PutUvarint(size, uint64(len(h.Type)))
+	data = append(data, size[:n]...)
+	data = append(data, h.Type...)
+	n = binary.PutUvarint(size, h.SchemaVersion)
+	data = append(data, size[:n]...)
+	return append(data, payload...)
+}
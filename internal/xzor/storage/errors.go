@@ -0,0 +1,35 @@
+package storage
+
+import "errors"
+
+// ErrNoTransactions occurs when a transaction is used with a record store that cannot commit batches.
+var ErrNoTransactions = errors.New("record store does not support transactions")
+
+// ErrConflict is matched by every ConflictError using errors.Is.
+var ErrConflict = errors.New("revision conflict")
+
+// ErrNotApplied is matched by every NotAppliedError using errors.Is.
+var ErrNotApplied = errors.New("batch committed but not applied")
+
+// ErrRecordNotFound occurs when reading a record that does not exist.
+var ErrRecordNotFound = errors.New("record not found")
+
+// ErrNoMigration occurs when a record cannot be upgraded to its current schema version
+// because a migration is missing.
+var ErrNoMigration = errors.New("no migration for the record's schema version")
+
+// ErrNewerSchema occurs when a record was written with a newer schema version than the record it is decoded into,
+// which would drop the fields the reader does not know about.
+var ErrNewerSchema = errors.New("record has a newer schema version")
+
+// ErrUnknownEncoding occurs when a record was written with an encoding the service cannot decode.
+var ErrUnknownEncoding = errors.New("unknown record encoding")
+
+// ErrWrongRecordType occurs when a record is decoded into a record of a different type.
+var ErrWrongRecordType = errors.New("stored record has a different type")
+
+// ErrUnknownIndex occurs when querying an index the service does not declare.
+var ErrUnknownIndex = errors.New("unknown index")
+
+// ErrInvalidIndex occurs when an index is missing its name or key function, or has a name containing a '.'.
+var ErrInvalidIndex = errors.New("invalid index")
@@ -0,0 +1,103 @@
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+	"github.com/xzor-dev/xzor/internal/xzor/storage"
+)
+
+// journalDir is the directory within a store's root holding its journal.
+// Record listings skip directories, so the journal never appears as a record.
+const journalDir = ".journal"
+
+var _ storage.BatchStore = &RecordStore{}
+
+// CommitBatch durably records the batch in the store's journal before applying it.
+// Once the journal is written the batch is committed: if applying it fails, a
+// storage.NotAppliedError is returned and the batch is completed by Recover or by the next CommitBatch.
+func (s *RecordStore) CommitBatch(b *storage.Batch) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	err := s.recover()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	err = common.WriteFile(s.journalFilename(), data, 0644)
+	if err != nil {
+		return err
+	}
+	err = s.applyJournal(b)
+	if err != nil {
+		return &storage.NotAppliedError{Err: err}
+	}
+	return nil
+}
+
+// Recover removes temporary files left by interrupted writes and completes
+// a batch left in the journal by an interrupted commit.
+// It should be called before the store is used after a crash.
+func (s *RecordStore) Recover() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	err := common.RemoveTempFiles(s.RootDir)
+	if err != nil {
+		return err
+	}
+	err = common.RemoveTempFiles(filepath.Join(s.RootDir, journalDir))
+	if err != nil {
+		return err
+	}
+	return s.recover()
+}
+
+func (s *RecordStore) journalFilename() string {
+	return filepath.Join(s.RootDir, journalDir, "batch")
+}
+
+func (s *RecordStore) recover() error {
+	data, err := ioutil.ReadFile(s.journalFilename())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	b := &storage.Batch{}
+	err = json.Unmarshal(data, b)
+	if err != nil {
+		return err
+	}
+	return s.applyJournal(b)
+}
+
+// applyJournal applies a journaled batch and removes it from the journal.
+// Applying a batch is idempotent, so a batch may be applied again after a crash.
+func (s *RecordStore) applyJournal(b *storage.Batch) error {
+	for _, op := range b.Ops {
+		if op.Delete {
+			err := s.delete(op.ID)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		err := s.write(op.ID, op.Data)
+		if err != nil {
+			return err
+		}
+	}
+	err := os.Remove(s.journalFilename())
+	if err != nil {
+		return err
+	}
+	return common.SyncDir(filepath.Join(s.RootDir, journalDir))
+}
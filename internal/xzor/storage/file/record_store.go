@@ -3,15 +3,21 @@ package file
 import (
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 
+	"github.com/xzor-dev/xzor/internal/xzor/common"
 	"github.com/xzor-dev/xzor/internal/xzor/storage"
 )
 
 var _ storage.RecordStore = &RecordStore{}
 
 // RecordStore stores and retrieves record data from the file system.
+// Reads and writes are serialized with batch commits, so a batch is applied atomically to readers.
 type RecordStore struct {
 	RootDir string
+
+	mux sync.RWMutex
 }
 
 func (s *RecordStore) filename(id storage.RecordID) string {
@@ -20,29 +26,63 @@ func (s *RecordStore) filename(id storage.RecordID) string {
 
 // Delete removes a record's data file.
 func (s *RecordStore) Delete(id storage.RecordID) error {
-	return os.Remove(s.filename(id))
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.delete(id)
+}
+
+// List returns the IDs of the record files matching the options.
+func (s *RecordStore) List(opts *storage.ListOptions) ([]storage.RecordID, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	files, err := ioutil.ReadDir(s.RootDir)
+	if os.IsNotExist(err) {
+		return []storage.RecordID{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	ids := make([]storage.RecordID, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || strings.HasSuffix(f.Name(), common.TempFileExt) {
+			continue
+		}
+		ids = append(ids, storage.RecordID(f.Name()))
+	}
+	return opts.Apply(ids), nil
 }
 
 // Read attempts to get a record's data from a file.
+// Directories are not records, so reading one returns ErrRecordNotFound.
 func (s *RecordStore) Read(id storage.RecordID) ([]byte, error) {
-	return ioutil.ReadFile(s.filename(id))
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	data, err := ioutil.ReadFile(s.filename(id))
+	if os.IsNotExist(err) {
+		return nil, storage.ErrRecordNotFound
+	} else if err != nil {
+		if info, serr := os.Stat(s.filename(id)); serr == nil && info.IsDir() {
+			return nil, storage.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return data, nil
 }
 
-// Write creates or replaces a file with the supplied data.
+// Write atomically creates or replaces a file with the supplied data.
 func (s *RecordStore) Write(id storage.RecordID, data []byte) error {
-	err := os.MkdirAll(s.RootDir, 0666)
-	if err != nil {
-		return err
-	}
-	f, err := os.Create(s.filename(id))
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+	s.mux.Lock()
+	defer s.mux.Unlock()
 
-	_, err = f.Write(data)
-	if err != nil {
-		return err
-	}
-	return nil
+	return s.write(id, data)
+}
+
+func (s *RecordStore) delete(id storage.RecordID) error {
+	return os.Remove(s.filename(id))
+}
+
+func (s *RecordStore) write(id storage.RecordID, data []byte) error {
+	return common.WriteFile(s.filename(id), data, 0644)
 }
@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+const (
+	indexEntryPrefix = "index."
+	indexKeysPrefix  = "index-keys."
+)
+
+// Index declares a secondary index over the records whose IDs start with Prefix.
+// Keys extracts the index keys of a record; a record may have any number of keys.
+// NewRecord should return a pointer to the indexed records' type and is used to
+// decode records when the index is rebuilt. Names must not be empty or contain a '.'.
+//
+// Index entries are stored as records alongside the records they index, using IDs
+// starting with "index." and "index-keys.", so record prefixes should not overlap them.
+// The service's listings and migrations skip them.
+type Index struct {
+	Keys      func(record interface{}) []string
+	Name      string
+	NewRecord func() interface{}
+	Prefix    string
+}
+
+func (idx *Index) entryID(key string, id RecordID) RecordID {
+	return RecordID(idx.entryPrefix() + key + "." + string(id))
+}
+
+func (idx *Index) entryPrefix() string {
+	return indexEntryPrefix + idx.Name + "."
+}
+
+func (idx *Index) keysID(id RecordID) RecordID {
+	return RecordID(idx.keysPrefix() + string(id))
+}
+
+func (idx *Index) keysPrefix() string {
+	return indexKeysPrefix + idx.Name + "."
+}
+
+// parseEntry returns the hex encoded key and the record ID of an index entry.
+func (idx *Index) parseEntry(entry RecordID) (string, RecordID, bool) {
+	s := strings.TrimPrefix(string(entry), idx.entryPrefix())
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return "", "", false
+	}
+	return s[:i], RecordID(s[i+1:]), true
+}
+
+func (idx *Index) validate() error {
+	if idx.Name == "" || strings.Contains(idx.Name, ".") || idx.Keys == nil {
+		return ErrInvalidIndex
+	}
+	return nil
+}
+
+// IndexEntry is a record ID found in an index along with its matching key.
+type IndexEntry struct {
+	ID  RecordID
+	Key string
+}
+
+// Lookup returns the IDs of the records with the key in the named index, ordered by ID.
+func (s *Service) Lookup(name string, key string) ([]RecordID, error) {
+	idx, err := s.index(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.Store.List(&ListOptions{
+		Prefix: idx.entryPrefix() + hex.EncodeToString([]byte(key)) + ".",
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]RecordID, 0, len(entries))
+	for _, entry := range entries {
+		if _, id, ok := idx.parseEntry(entry); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// LookupRange returns the entries of the named index with keys from start up to, but not including, end,
+// ordered by key and then by ID. An empty end leaves the range unbounded, and limit caps
+// the number of entries returned when greater than zero.
+func (s *Service) LookupRange(name string, start string, end string, limit int) ([]*IndexEntry, error) {
+	idx, err := s.index(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.Store.List(&ListOptions{
+		After:  RecordID(idx.entryPrefix() + hex.EncodeToString([]byte(start))),
+		Prefix: idx.entryPrefix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	hexEnd := hex.EncodeToString([]byte(end))
+	found := make([]*IndexEntry, 0)
+	for _, entry := range entries {
+		if limit > 0 && len(found) == limit {
+			break
+		}
+		hexKey, id, ok := idx.parseEntry(entry)
+		if !ok {
+			continue
+		}
+		if end != "" && hexKey >= hexEnd {
+			break
+		}
+		key, err := hex.DecodeString(hexKey)
+		if err != nil {
+			continue
+		}
+		found = append(found, &IndexEntry{
+			ID:  id,
+			Key: string(key),
+		})
+	}
+	return found, nil
+}
+
+// RebuildIndex rewrites the entries of the named index from the records it covers,
+// removing entries of records that no longer exist or whose keys have changed.
+// Records are reindexed one at a time, so writes may continue during the rebuild.
+func (s *Service) RebuildIndex(name string) error {
+	idx, err := s.index(name)
+	if err != nil {
+		return err
+	}
+	if idx.NewRecord == nil {
+		return ErrInvalidIndex
+	}
+
+	ids, err := s.Store.List(&ListOptions{Prefix: idx.Prefix})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if isIndexRecord(id) {
+			continue
+		}
+		err := s.reindex(idx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	keys, err := s.Store.List(&ListOptions{Prefix: idx.keysPrefix()})
+	if err != nil {
+		return err
+	}
+	for _, keysID := range keys {
+		err := s.reindex(idx, RecordID(strings.TrimPrefix(string(keysID), idx.keysPrefix())))
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := s.Store.List(&ListOptions{Prefix: idx.entryPrefix()})
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		hexKey, id, ok := idx.parseEntry(entry)
+		if !ok {
+			continue
+		}
+		err := s.removeStaleEntry(idx, entry, hexKey, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// index returns the service's index with the name.
+func (s *Service) index(name string) (*Index, error) {
+	for _, idx := range s.Indexes {
+		if idx.Name == name {
+			return idx, idx.validate()
+		}
+	}
+	return nil, ErrUnknownIndex
+}
+
+// reindex replaces the entries of a record in an index with the keys of its current value.
+func (s *Service) reindex(idx *Index, id RecordID) error {
+	unlock := s.locks.lock(id)
+	defer unlock()
+
+	record := idx.NewRecord()
+	_, err := s.readRevision(id, record)
+	if err == ErrRecordNotFound {
+		record = nil
+	} else if err != nil {
+		return err
+	}
+	ix := &indexer{
+		batch:   &Batch{},
+		indexes: []*Index{idx},
+		service: s,
+	}
+	err = ix.update(id, record)
+	if err != nil {
+		return err
+	}
+	return s.commit(ix.batch)
+}
+
+// removeStaleEntry deletes an index entry when the record's stored keys no longer include its key.
+func (s *Service) removeStaleEntry(idx *Index, entry RecordID, hexKey string, id RecordID) error {
+	unlock := s.locks.lock(id)
+	defer unlock()
+
+	keys, err := s.indexKeys(idx, id)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if k == hexKey {
+			return nil
+		}
+	}
+	return s.Store.Delete(entry)
+}
+
+// indexKeys returns the hex encoded keys stored for a record in an index.
+func (s *Service) indexKeys(idx *Index, id RecordID) ([]string, error) {
+	data, err := s.Store.Read(idx.keysID(id))
+	if err == ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return strings.Split(string(data), "\n"), nil
+}
+
+// indexer adds the index entry changes caused by record writes and deletes to a batch.
+type indexer struct {
+	batch   *Batch
+	indexes []*Index
+	keys    map[RecordID][]string
+	service *Service
+}
+
+// update adds the entry changes for a record being written, or deleted when record is nil.
+func (ix *indexer) update(id RecordID, record interface{}) error {
+	for _, idx := range ix.indexes {
+		if !strings.HasPrefix(string(id), idx.Prefix) || isIndexRecord(id) {
+			continue
+		}
+		err := idx.validate()
+		if err != nil {
+			return err
+		}
+		keysID := idx.keysID(id)
+		old, ok := ix.keys[keysID]
+		if !ok {
+			old, err = ix.service.indexKeys(idx, id)
+			if err != nil {
+				return err
+			}
+		}
+		var keys []string
+		if record != nil {
+			keys = hexKeys(idx.Keys(record))
+		}
+
+		for _, k := range old {
+			if !containsKey(keys, k) {
+				ix.batch.Delete(idx.entryID(k, id))
+			}
+		}
+		for _, k := range keys {
+			if !containsKey(old, k) {
+				ix.batch.Write(idx.entryID(k, id), []byte{})
+			}
+		}
+		if len(keys) > 0 {
+			ix.batch.Write(keysID, []byte(strings.Join(keys, "\n")))
+		} else if len(old) > 0 {
+			ix.batch.Delete(keysID)
+		}
+
+		if ix.keys == nil {
+			ix.keys = make(map[RecordID][]string)
+		}
+		ix.keys[keysID] = keys
+	}
+	return nil
+}
+
+// listRecords lists the IDs of the records matching the options, skipping index entries.
+// When a limit is set the store is listed a page at a time, so skipped entries do not shorten the listing.
+func (s *Service) listRecords(opts *ListOptions) ([]RecordID, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	page := *opts
+	ids := make([]RecordID, 0)
+	for {
+		listed, err := s.Store.List(&page)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range listed {
+			if !isIndexRecord(id) {
+				ids = append(ids, id)
+			}
+		}
+		if opts.Limit <= 0 || len(listed) < opts.Limit || len(ids) >= opts.Limit {
+			break
+		}
+		page.After = listed[len(listed)-1]
+	}
+	if opts.Limit > 0 && len(ids) > opts.Limit {
+		ids = ids[:opts.Limit]
+	}
+	return ids, nil
+}
+
+// isIndexRecord reports whether a record ID belongs to an index entry rather than an indexed record.
+func isIndexRecord(id RecordID) bool {
+	return strings.HasPrefix(string(id), indexEntryPrefix) || strings.HasPrefix(string(id), indexKeysPrefix)
+}
+
+// containsKey reports whether a sorted set of keys contains the key.
+func containsKey(keys []string, key string) bool {
+	i := sort.SearchStrings(keys, key)
+	return i < len(keys) && keys[i] == key
+}
+
+// hexKeys returns the sorted, unique hex encodings of a record's index keys.
+func hexKeys(keys []string) []string {
+	encoded := make([]string, 0, len(keys))
+	for _, k := range keys {
+		encoded = append(encoded, hex.EncodeToString([]byte(k)))
+	}
+	sort.Strings(encoded)
+	unique := encoded[:0]
+	for i, k := range encoded {
+		if i == 0 || k != encoded[i-1] {
+			unique = append(unique, k)
+		}
+	}
+	return unique
+}
@@ -7,6 +7,7 @@ import (
 )
 
 var _ storage.RecordEncodeDecoder = &EncodeDecoder{}
+var _ storage.EncodingIdentifier = &EncodeDecoder{}
 
 // EncodeDecoder provides methods to encode and decode records into and from JSON strings.
 type EncodeDecoder struct{}
@@ -16,6 +17,11 @@ func (ed *EncodeDecoder) DecodeRecord(data []byte, record interface{}) error {
 	return json.Unmarshal(data, record)
 }
 
+// Encoding returns the ID stored in the header of records encoded as JSON.
+func (ed *EncodeDecoder) Encoding() string {
+	return "json"
+}
+
 // EncodeRecord converts a record interface into a JSON byte slice.
 func (ed *EncodeDecoder) EncodeRecord(record interface{}) ([]byte, error) {
 	return json.Marshal(record)
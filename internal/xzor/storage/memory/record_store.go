@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/xzor-dev/xzor/internal/xzor/storage"
+)
+
+var _ storage.RecordStore = &RecordStore{}
+var _ storage.BatchStore = &RecordStore{}
+
+// RecordStore stores record data in memory.
+type RecordStore struct {
+	mux     sync.RWMutex
+	records map[storage.RecordID][]byte
+}
+
+// CommitBatch applies every operation in the batch while holding the store's lock,
+// so no reader sees a partially applied batch.
+func (s *RecordStore) CommitBatch(b *storage.Batch) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.records == nil {
+		s.records = make(map[storage.RecordID][]byte)
+	}
+	for _, op := range b.Ops {
+		if op.Delete {
+			delete(s.records, op.ID)
+			continue
+		}
+		stored := make([]byte, len(op.Data))
+		copy(stored, op.Data)
+		s.records[op.ID] = stored
+	}
+	return nil
+}
+
+// Delete removes a record from memory.
+func (s *RecordStore) Delete(id storage.RecordID) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.records != nil {
+		delete(s.records, id)
+	}
+	return nil
+}
+
+// List returns the IDs of the records in memory matching the options.
+func (s *RecordStore) List(opts *storage.ListOptions) ([]storage.RecordID, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	ids := make([]storage.RecordID, 0, len(s.records))
+	for id := range s.records {
+		ids = append(ids, id)
+	}
+	return opts.Apply(ids), nil
+}
+
+// Read attempts to get a record's data from memory.
+func (s *RecordStore) Read(id storage.RecordID) ([]byte, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if s.records == nil || s.records[id] == nil {
+		return nil, storage.ErrRecordNotFound
+	}
+	data := make([]byte, len(s.records[id]))
+	copy(data, s.records[id])
+	return data, nil
+}
+
+// Write adds or replaces a record's data in memory.
+func (s *RecordStore) Write(id storage.RecordID, data []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.records == nil {
+		s.records = make(map[storage.RecordID][]byte)
+	}
+	stored := make([]byte, len(data))
+	copy(stored, data)
+	s.records[id] = stored
+	return nil
+}
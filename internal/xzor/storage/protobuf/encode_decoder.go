@@ -0,0 +1,54 @@
+package protobuf
+
+import (
+	"errors"
+
+	"github.com/xzor-dev/xzor/internal/xzor/storage"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ storage.RecordEncodeDecoder = &EncodeDecoder{}
+var _ storage.EncodingIdentifier = &EncodeDecoder{}
+
+// EncodeDecoder provides methods to encode and decode records into and from protobuf messages.
+// Records must either be generated protobuf messages or implement Record.
+type EncodeDecoder struct{}
+
+// DecodeRecord converts protobuf data into the supplied record.
+func (ed *EncodeDecoder) DecodeRecord(data []byte, record interface{}) error {
+	switch r := record.(type) {
+	case proto.Message:
+		return proto.Unmarshal(data, r)
+	case Record:
+		m := r.NewProto()
+		err := proto.Unmarshal(data, m)
+		if err != nil {
+			return err
+		}
+		return r.FromProto(m)
+	}
+	return errors.New("record does not have a protobuf schema")
+}
+
+// Encoding returns the ID stored in the header of records encoded as protobuf.
+func (ed *EncodeDecoder) Encoding() string {
+	return "protobuf"
+}
+
+// EncodeRecord converts a record into protobuf data.
+func (ed *EncodeDecoder) EncodeRecord(record interface{}) ([]byte, error) {
+	switch r := record.(type) {
+	case proto.Message:
+		return proto.Marshal(r)
+	case Record:
+		return proto.Marshal(r.ToProto())
+	}
+	return nil, errors.New("record does not have a protobuf schema")
+}
+
+// Record is implemented by records that convert to and from a generated protobuf message.
+type Record interface {
+	FromProto(proto.Message) error
+	NewProto() proto.Message
+	ToProto() proto.Message
+}
@@ -1,5 +1,67 @@
 package storage
 
+import (
+	"sort"
+	"strings"
+)
+
+// ListOptions controls which record IDs are listed and in what order.
+// IDs are ordered lexically, or in reverse when Reverse is set. After is a cursor
+// excluding every ID up to and including itself in the listing order, and Limit
+// caps the number of IDs returned when greater than zero.
+type ListOptions struct {
+	After   RecordID
+	Limit   int
+	Prefix  string
+	Reverse bool
+}
+
+// Apply filters, orders and limits a set of record IDs according to the options.
+// A nil ListOptions lists every ID in lexical order.
+func (o *ListOptions) Apply(ids []RecordID) []RecordID {
+	if o == nil {
+		o = &ListOptions{}
+	}
+	selected := make([]RecordID, 0, len(ids))
+	for _, id := range ids {
+		if !strings.HasPrefix(string(id), o.Prefix) {
+			continue
+		}
+		if o.After != "" && (!o.Reverse && id <= o.After || o.Reverse && id >= o.After) {
+			continue
+		}
+		selected = append(selected, id)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		if o.Reverse {
+			return selected[i] > selected[j]
+		}
+		return selected[i] < selected[j]
+	})
+	if o.Limit > 0 && len(selected) > o.Limit {
+		selected = selected[:o.Limit]
+	}
+	return selected
+}
+
+// cachedRecord is a decoded record held in a service's cache along with its revision.
+type cachedRecord struct {
+	record   interface{}
+	revision Revision
+}
+
+// Record pairs a decoded record with its ID.
+type Record struct {
+	ID    RecordID
+	Value interface{}
+}
+
+// RecordCopier is implemented by records that can be deep copied, allowing a service
+// to cache them decoded. CopyRecord must return a pointer of the record's own type.
+type RecordCopier interface {
+	CopyRecord() interface{}
+}
+
 // RecordDecoder decodes a record's encoded data.
 type RecordDecoder interface {
 	DecodeRecord([]byte, interface{}) error
@@ -19,9 +81,11 @@ type RecordEncodeDecoder interface {
 // RecordID is used to identify individual stored records.
 type RecordID string
 
-// RecordStore is used to delete, read, and write record data.
+// RecordStore is used to delete, list, read, and write record data.
+// Read returns ErrRecordNotFound for records that do not exist.
 type RecordStore interface {
 	Delete(RecordID) error
+	List(*ListOptions) ([]RecordID, error)
 	Read(RecordID) ([]byte, error)
 	Write(RecordID, []byte) error
 }
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultMaxRetries is the number of times Update retries a conflicting transaction
+// when the service does not set its own limit.
+const DefaultMaxRetries = 10
+
+// ConflictError occurs when a record's revision does not match the revision a write expected,
+// meaning another writer updated the record first.
+type ConflictError struct {
+	Actual   Revision
+	Expected Revision
+	ID       RecordID
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("revision conflict on record %s: expected revision %d, found %d", e.ID, e.Expected, e.Actual)
+}
+
+// Is reports whether the target is ErrConflict, allowing errors.Is to match any ConflictError.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Revision counts the writes made to a record. A record that does not exist has revision 0.
+type Revision uint64
+
+// recordLocks serializes writers of the same record within a service.
+type recordLocks struct {
+	locks map[RecordID]*recordLock
+	mux   sync.Mutex
+}
+
+type recordLock struct {
+	mux  sync.Mutex
+	refs int
+}
+
+// lock acquires the locks of the provided records in a consistent order and returns
+// a function releasing them.
+func (l *recordLocks) lock(ids ...RecordID) func() {
+	unique := make(map[RecordID]bool, len(ids))
+	sorted := make([]RecordID, 0, len(ids))
+	for _, id := range ids {
+		if !unique[id] {
+			unique[id] = true
+			sorted = append(sorted, id)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	held := make([]*recordLock, len(sorted))
+	for i, id := range sorted {
+		l.mux.Lock()
+		if l.locks == nil {
+			l.locks = make(map[RecordID]*recordLock)
+		}
+		rl := l.locks[id]
+		if rl == nil {
+			rl = &recordLock{}
+			l.locks[id] = rl
+		}
+		rl.refs++
+		l.mux.Unlock()
+
+		rl.mux.Lock()
+		held[i] = rl
+	}
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].mux.Unlock()
+			l.mux.Lock()
+			held[i].refs--
+			if held[i].refs == 0 {
+				delete(l.locks, sorted[i])
+			}
+			l.mux.Unlock()
+		}
+	}
+}
@@ -1,39 +1,457 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"reflect"
+
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+)
 
 // Service handles the IO of stored records.
+// Every record written by the service carries a header holding its revision, which is incremented
+// on each write, along with its encoding and, for a VersionedRecord, its type and schema version.
+// Conditional writes are serialized per record within the service, so writers sharing
+// a record store should share a service.
+//
+// Records written with another encoding are decoded using Decoders, keyed by encoding ID,
+// and records written with an older schema version are upgraded using Migrations when read.
+// The entries of Indexes are updated along with the records they cover, atomically when
+// the record store implements BatchStore.
+//
+// Records implementing RecordCopier are kept decoded in Cache, when set, sized by the length of
+// their stored data. Records written to the store by another service are not seen until evicted.
 type Service struct {
+	Cache         *common.LRU
+	Decoders      map[string]RecordEncodeDecoder
 	EncodeDecoder RecordEncodeDecoder
+	Indexes       []*Index
+	MaxRetries    int
+	Migrations    *Migrations
 	Store         RecordStore
+
+	locks recordLocks
+}
+
+// CompareAndWrite encodes and writes a record only if its current revision matches the expected revision,
+// returning the record's new revision. A ConflictError is returned when the revisions differ.
+// An expected revision of 0 requires that the record does not exist.
+func (s *Service) CompareAndWrite(id RecordID, record interface{}, expected Revision) (Revision, error) {
+	h, payload, err := s.encode(record)
+	if err != nil {
+		return 0, err
+	}
+	unlock := s.locks.lock(id)
+	defer unlock()
+
+	rev, err := s.revision(id)
+	if err != nil {
+		return 0, err
+	}
+	if rev != expected {
+		return 0, &ConflictError{
+			Actual:   rev,
+			Expected: expected,
+			ID:       id,
+		}
+	}
+	h.Revision = rev + 1
+	err = s.writeRecord(id, record, encodeHeader(h, payload))
+	if err != nil {
+		return 0, err
+	}
+	return rev + 1, nil
 }
 
 // Delete removes a record by its ID from the record store.
 func (s *Service) Delete(id RecordID) error {
-	return s.Store.Delete(id)
+	unlock := s.locks.lock(id)
+	defer unlock()
+	defer s.Cache.Remove(string(id))
+
+	ix := s.newIndexer()
+	ix.batch.Delete(id)
+	err := ix.update(id, nil)
+	if err != nil {
+		return err
+	}
+	return s.commit(ix.batch)
+}
+
+// List returns the IDs of the records in the store matching the options, excluding index entries.
+func (s *Service) List(opts *ListOptions) ([]RecordID, error) {
+	return s.listRecords(opts)
+}
+
+// ListRecords lists the records matching the options and decodes each into a new record
+// created by newRecord, which should return a pointer to the record's type.
+// The ID of the last record can be used as the After cursor for the next page.
+func (s *Service) ListRecords(opts *ListOptions, newRecord func() interface{}) ([]*Record, error) {
+	if s.EncodeDecoder == nil {
+		return nil, errors.New("no EncodeDecoder provided to the service")
+	}
+	ids, err := s.listRecords(opts)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*Record, len(ids))
+	for i, id := range ids {
+		record := newRecord()
+		err := s.Read(id, record)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = &Record{
+			ID:    id,
+			Value: record,
+		}
+	}
+	return records, nil
+}
+
+// Migrate rewrites the records matching the options that were written with another encoding
+// or an older schema version, using the service's current encoding and the records' current
+// schema versions. newRecord should return a pointer to the records' type.
+// Records of another type are skipped, as are records stored without a type unless the
+// options select them by prefix, since they may be of any type.
+// Records updated by another writer during the migration are left as written.
+// The number of records rewritten is returned.
+func (s *Service) Migrate(opts *ListOptions, newRecord func() interface{}) (int, error) {
+	current, _, err := s.encode(newRecord())
+	if err != nil {
+		return 0, err
+	}
+	ids, err := s.listRecords(opts)
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, id := range ids {
+		data, err := s.Store.Read(id)
+		if err != nil {
+			return migrated, err
+		}
+		h, _, err := decodeHeader(data)
+		if err != nil {
+			return migrated, err
+		}
+		if h.Encoding == current.Encoding && h.Type == current.Type && h.SchemaVersion == current.SchemaVersion {
+			continue
+		}
+		if h.Type == "" && (opts == nil || opts.Prefix == "") || h.Type != "" && h.Type != current.Type {
+			continue
+		}
+		record := newRecord()
+		rev, err := s.decode(data, record)
+		if err != nil {
+			return migrated, err
+		}
+		_, err = s.CompareAndWrite(id, record, rev)
+		if errors.Is(err, ErrConflict) {
+			continue
+		} else if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
 }
 
 // Read gets a record's encoded data from the store and decodes it into the provided record.
 func (s *Service) Read(id RecordID, record interface{}) error {
-	if s.EncodeDecoder == nil {
-		return errors.New("no EncodeDecoder provided to the service")
+	_, err := s.ReadRevision(id, record)
+	return err
+}
+
+// ReadRevision reads a record like Read and returns its current revision,
+// to be passed to CompareAndWrite when writing the record back.
+func (s *Service) ReadRevision(id RecordID, record interface{}) (Revision, error) {
+	if s.Cache != nil {
+		// Reads hold the record's lock while filling the cache so a record read
+		// before a write cannot replace it in the cache.
+		unlock := s.locks.lock(id)
+		defer unlock()
 	}
+	return s.readRevision(id, record)
+}
 
-	data, err := s.Store.Read(id)
+// Transaction runs fn and commits the writes and deletes it makes as a single batch.
+// Nothing is committed if fn returns an error. If a record read within the transaction
+// was written by someone else before the commit, a ConflictError is returned and nothing is committed.
+// The record store must implement BatchStore.
+func (s *Service) Transaction(fn func(*Tx) error) error {
+	bs, ok := s.Store.(BatchStore)
+	if !ok {
+		return ErrNoTransactions
+	}
+	tx := &Tx{
+		batch:   &Batch{},
+		reads:   make(map[RecordID]Revision),
+		service: s,
+	}
+	err := fn(tx)
 	if err != nil {
 		return err
 	}
-	return s.EncodeDecoder.DecodeRecord(data, record)
+	if len(tx.batch.Ops) == 0 {
+		return nil
+	}
+
+	ids := make([]RecordID, 0, len(tx.batch.Ops)+len(tx.reads))
+	for _, op := range tx.batch.Ops {
+		ids = append(ids, op.ID)
+	}
+	for id := range tx.reads {
+		ids = append(ids, id)
+	}
+	unlock := s.locks.lock(ids...)
+	defer unlock()
+
+	revs := make(map[RecordID]Revision)
+	for _, id := range ids {
+		if _, ok := revs[id]; ok {
+			continue
+		}
+		rev, err := s.revision(id)
+		if err != nil {
+			return err
+		}
+		if expected, ok := tx.reads[id]; ok && rev != expected {
+			return &ConflictError{
+				Actual:   rev,
+				Expected: expected,
+				ID:       id,
+			}
+		}
+		revs[id] = rev
+	}
+	ix := s.newIndexer()
+	defer func() {
+		for _, op := range tx.batch.Ops {
+			s.Cache.Remove(string(op.ID))
+		}
+	}()
+	for i, op := range tx.batch.Ops {
+		if op.Delete {
+			ix.batch.Delete(op.ID)
+		} else {
+			revs[op.ID]++
+			h := tx.headers[i]
+			h.Revision = revs[op.ID]
+			ix.batch.Write(op.ID, encodeHeader(h, op.Data))
+		}
+		err := ix.update(op.ID, tx.records[i])
+		if err != nil {
+			return err
+		}
+	}
+	return bs.CommitBatch(ix.batch)
 }
 
-// Write encodes a record and writes it to the record store.
+// Update runs a read-modify-write transaction, retrying it from the start
+// whenever it conflicts with another writer, up to the service's MaxRetries.
+func (s *Service) Update(fn func(*Tx) error) error {
+	retries := s.MaxRetries
+	if retries <= 0 {
+		retries = DefaultMaxRetries
+	}
+	var err error
+	for i := 0; i <= retries; i++ {
+		err = s.Transaction(fn)
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// Write encodes a record and writes it to the record store, regardless of its current revision.
 func (s *Service) Write(id RecordID, record interface{}) error {
+	h, payload, err := s.encode(record)
+	if err != nil {
+		return err
+	}
+	unlock := s.locks.lock(id)
+	defer unlock()
+
+	rev, err := s.revision(id)
+	if err != nil {
+		return err
+	}
+	h.Revision = rev + 1
+	return s.writeRecord(id, record, encodeHeader(h, payload))
+}
+
+// commit applies a batch, atomically when the record store implements BatchStore.
+// A batch holding a single operation is applied directly.
+func (s *Service) commit(b *Batch) error {
+	if bs, ok := s.Store.(BatchStore); ok && len(b.Ops) > 1 {
+		err := bs.CommitBatch(b)
+		if err != ErrNoTransactions {
+			return err
+		}
+	}
+	for _, op := range b.Ops {
+		var err error
+		if op.Delete {
+			err = s.Store.Delete(op.ID)
+		} else {
+			err = s.Store.Write(op.ID, op.Data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decode decodes stored data into the record, migrating it to the record's current schema version
+// if needed, and returns the stored revision.
+// Records stored without a type are assumed to have been written with schema version 1.
+// ErrNewerSchema is returned for records written with a newer schema version than the record's.
+func (s *Service) decode(data []byte, record interface{}) (Revision, error) {
+	h, payload, err := decodeHeader(data)
+	if err != nil {
+		return 0, err
+	}
+	ed, err := s.decoder(h.Encoding)
+	if err != nil {
+		return 0, err
+	}
+	if v, ok := record.(VersionedRecord); ok {
+		from := h.SchemaVersion
+		if h.Type == "" {
+			from = 1
+		} else if h.Type != v.RecordType() {
+			return 0, ErrWrongRecordType
+		}
+		if from > v.SchemaVersion() {
+			return 0, ErrNewerSchema
+		}
+		if from < v.SchemaVersion() {
+			if s.Migrations == nil {
+				return 0, ErrNoMigration
+			}
+			payload, err = s.Migrations.migrate(v.RecordType(), from, v.SchemaVersion(), payload, ed)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	err = ed.DecodeRecord(payload, record)
+	if err != nil {
+		return 0, err
+	}
+	return h.Revision, nil
+}
+
+// decoder returns the encode decoder for records written with the encoding.
+// Records without an encoding ID are decoded using the service's EncodeDecoder.
+func (s *Service) decoder(encoding string) (RecordEncodeDecoder, error) {
+	if encoding == "" || encoding == s.encoding() {
+		return s.EncodeDecoder, nil
+	}
+	ed := s.Decoders[encoding]
+	if ed == nil {
+		return nil, ErrUnknownEncoding
+	}
+	return ed, nil
+}
+
+// encode encodes a record and returns the header to be written before it.
+func (s *Service) encode(record interface{}) (*recordHeader, []byte, error) {
 	if s.EncodeDecoder == nil {
-		return errors.New("no EncodeDecoder provided to t he service")
+		return nil, nil, errors.New("no EncodeDecoder provided to t he service")
+	}
+	payload, err := s.EncodeDecoder.EncodeRecord(record)
+	if err != nil {
+		return nil, nil, err
 	}
-	data, err := s.EncodeDecoder.EncodeRecord(record)
+	h := &recordHeader{
+		Encoding: s.encoding(),
+	}
+	if v, ok := record.(VersionedRecord); ok {
+		h.SchemaVersion = v.SchemaVersion()
+		h.Type = v.RecordType()
+	}
+	return h, payload, nil
+}
+
+// encoding returns the ID of the service's encoding, if its EncodeDecoder provides one.
+func (s *Service) encoding() string {
+	if id, ok := s.EncodeDecoder.(EncodingIdentifier); ok {
+		return id.Encoding()
+	}
+	return ""
+}
+
+// newIndexer returns an indexer adding changes for every index of the service to a new batch.
+func (s *Service) newIndexer() *indexer {
+	return &indexer{
+		batch:   &Batch{},
+		indexes: s.Indexes,
+		service: s,
+	}
+}
+
+// readRevision reads and decodes a record, using the cache for records implementing RecordCopier.
+func (s *Service) readRevision(id RecordID, record interface{}) (Revision, error) {
+	if s.EncodeDecoder == nil {
+		return 0, errors.New("no EncodeDecoder provided to the service")
+	}
+	copier, cacheable := record.(RecordCopier)
+	cacheable = cacheable && s.Cache != nil
+	if cacheable {
+		if cached, ok := s.Cache.Get(string(id)); ok {
+			c := cached.(*cachedRecord)
+			if reflect.TypeOf(c.record) == reflect.TypeOf(record) {
+				copied := c.record.(RecordCopier).CopyRecord()
+				reflect.ValueOf(record).Elem().Set(reflect.ValueOf(copied).Elem())
+				return c.revision, nil
+			}
+		}
+	}
+
+	data, err := s.Store.Read(id)
+	if err != nil {
+		return 0, err
+	}
+	rev, err := s.decode(data, record)
+	if err != nil {
+		return 0, err
+	}
+	if cacheable {
+		s.Cache.Add(string(id), &cachedRecord{
+			record:   copier.CopyRecord(),
+			revision: rev,
+		}, len(data))
+	}
+	return rev, nil
+}
+
+// revision returns a record's current revision, or 0 when the record does not exist.
+func (s *Service) revision(id RecordID) (Revision, error) {
+	data, err := s.Store.Read(id)
+	if err == ErrRecordNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	h, _, err := decodeHeader(data)
+	if err != nil {
+		return 0, err
+	}
+	return h.Revision, nil
+}
+
+// writeRecord writes a record's encoded data along with its index entries.
+func (s *Service) writeRecord(id RecordID, record interface{}, data []byte) error {
+	defer s.Cache.Remove(string(id))
+
+	ix := s.newIndexer()
+	ix.batch.Write(id, data)
+	err := ix.update(id, record)
 	if err != nil {
 		return err
 	}
-	return s.Store.Write(id, data)
+	return s.commit(ix.batch)
 }
@@ -1,13 +1,28 @@
 package storage_test
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/xzor-dev/xzor/internal/xzor/block"
+	blockmemory "github.com/xzor-dev/xzor/internal/xzor/block/memory"
+	"github.com/xzor-dev/xzor/internal/xzor/common"
+	"github.com/xzor-dev/xzor/internal/xzor/encryption"
 	"github.com/xzor-dev/xzor/internal/xzor/storage"
+	"github.com/xzor-dev/xzor/internal/xzor/storage/cache"
+	"github.com/xzor-dev/xzor/internal/xzor/storage/cbor"
+	"github.com/xzor-dev/xzor/internal/xzor/storage/chain"
+	"github.com/xzor-dev/xzor/internal/xzor/storage/encrypted"
 	"github.com/xzor-dev/xzor/internal/xzor/storage/file"
 	"github.com/xzor-dev/xzor/internal/xzor/storage/json"
+	"github.com/xzor-dev/xzor/internal/xzor/storage/memory"
+	"github.com/xzor-dev/xzor/internal/xzor/storage/protobuf"
 )
 
 func TestStorageService(t *testing.T) {
@@ -79,6 +94,1053 @@ func TestJSONFileStorage(t *testing.T) {
 	}
 }
 
+func TestListRecords(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	stores := map[string]storage.RecordStore{
+		"file": &file.RecordStore{
+			RootDir: dir + "/testdata/list",
+		},
+		"memory": &memory.RecordStore{},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := &storage.Service{
+				EncodeDecoder: &json.EncodeDecoder{},
+				Store:         store,
+			}
+			ids := []storage.RecordID{"board-c", "board-a", "thread-a", "board-b"}
+			for _, id := range ids {
+				err := s.Write(id, string(id))
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+			}
+			defer func() {
+				for _, id := range ids {
+					s.Delete(id)
+				}
+			}()
+
+			page, err := s.List(&storage.ListOptions{
+				Limit:  2,
+				Prefix: "board-",
+			})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if len(page) != 2 || page[0] != "board-a" || page[1] != "board-b" {
+				t.Fatalf("unexpected first page: %v", page)
+			}
+			page, err = s.List(&storage.ListOptions{
+				After:  page[1],
+				Limit:  2,
+				Prefix: "board-",
+			})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if len(page) != 1 || page[0] != "board-c" {
+				t.Fatalf("unexpected second page: %v", page)
+			}
+
+			records, err := s.ListRecords(&storage.ListOptions{
+				Prefix:  "board-",
+				Reverse: true,
+			}, func() interface{} {
+				return new(string)
+			})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if len(records) != 3 || records[0].ID != "board-c" || *records[0].Value.(*string) != "board-c" {
+				t.Fatal("expected records to be decoded in reverse order")
+			}
+		})
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	rootDir := dir + "/testdata/transactions"
+	store := &file.RecordStore{
+		RootDir: rootDir,
+	}
+	s := &storage.Service{
+		EncodeDecoder: &json.EncodeDecoder{},
+		Store:         store,
+	}
+	defer os.RemoveAll(rootDir)
+
+	err = s.Write("a", "old")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = s.Transaction(func(tx *storage.Tx) error {
+		tx.Delete("a")
+		err := tx.Write("b", "new")
+		if err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Fatal("expected the transaction to fail")
+	}
+	ids, err := s.List(nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(ids) != 1 || ids[0] != "a" {
+		t.Fatalf("expected an aborted transaction to leave the store untouched, got %v", ids)
+	}
+
+	// A directory in place of record "c" makes the batch fail partway through applying,
+	// as if the process had crashed after the journal was written.
+	err = os.MkdirAll(rootDir+"/c/blocked", 0755)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = s.Transaction(func(tx *storage.Tx) error {
+		tx.Delete("a")
+		err := tx.Write("b", "new")
+		if err != nil {
+			return err
+		}
+		return tx.Write("c", "new")
+	})
+	if !errors.Is(err, storage.ErrNotApplied) {
+		t.Fatalf("expected the batch to be committed but fail while being applied, got %v", err)
+	}
+	err = os.RemoveAll(rootDir + "/c")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = store.Recover()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ids, err = s.List(nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(ids) != 2 || ids[0] != "b" || ids[1] != "c" {
+		t.Fatalf("expected recovery to complete the journaled batch, got %v", ids)
+	}
+	_, err = os.Stat(rootDir + "/.journal/batch")
+	if !os.IsNotExist(err) {
+		t.Fatal("expected the journal to be removed after recovery")
+	}
+
+	// Batches committed to the store directly are completed by its next commit.
+	err = os.MkdirAll(rootDir+"/d/blocked", 0755)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	batch := &storage.Batch{}
+	batch.Delete("b")
+	batch.Write("d", []byte("new"))
+	err = store.CommitBatch(batch)
+	if !errors.Is(err, storage.ErrNotApplied) {
+		t.Fatalf("expected the batch to be committed but fail while being applied, got %v", err)
+	}
+	err = os.RemoveAll(rootDir + "/d")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = store.CommitBatch(&storage.Batch{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ids, err = s.List(nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(ids) != 2 || ids[0] != "c" || ids[1] != "d" {
+		t.Fatalf("expected the next commit to complete the journaled batch, got %v", ids)
+	}
+
+	unbatched := &storage.Service{
+		EncodeDecoder: &testEncodeDecoder{},
+		Store:         &testRecordStore{},
+	}
+	err = unbatched.Transaction(func(tx *storage.Tx) error {
+		return nil
+	})
+	if err != storage.ErrNoTransactions {
+		t.Fatalf("expected ErrNoTransactions, got %v", err)
+	}
+}
+
+func TestConcurrentBatches(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	store := &file.RecordStore{
+		RootDir: dir + "/testdata/concurrent",
+	}
+	defer os.RemoveAll(store.RootDir)
+
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			ids, err := store.List(nil)
+			if err != nil {
+				t.Errorf("%v", err)
+				return
+			}
+			if len(ids)%2 != 0 {
+				t.Errorf("expected batches to be listed whole, got %v", ids)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		b := &storage.Batch{}
+		b.Write(storage.RecordID(fmt.Sprintf("a%02d", i)), []byte("a"))
+		b.Write(storage.RecordID(fmt.Sprintf("b%02d", i)), []byte("b"))
+		err := store.CommitBatch(b)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestInterruptedWrites(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	rootDir := dir + "/testdata/interrupted"
+	store := &file.RecordStore{
+		RootDir: rootDir,
+	}
+	defer os.RemoveAll(rootDir)
+
+	err = store.Write("a", []byte("complete"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	info, err := os.Stat(rootDir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Fatalf("unexpected directory permissions: %v", info.Mode().Perm())
+	}
+
+	// A crash while replacing the record leaves a partially written temporary file behind.
+	tmp := rootDir + "/a.123456.tmp"
+	err = ioutil.WriteFile(tmp, []byte("compl"), 0644)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	data, err := store.Read("a")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(data) != "complete" {
+		t.Fatalf("expected the previous record to survive an interrupted write, got %s", data)
+	}
+	ids, err := store.List(nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(ids) != 1 {
+		t.Fatalf("expected temporary files to be excluded from listings, got %v", ids)
+	}
+	err = store.Recover()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = os.Stat(tmp)
+	if !os.IsNotExist(err) {
+		t.Fatal("expected recovery to remove the temporary file")
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	s := &storage.Service{
+		EncodeDecoder: &json.EncodeDecoder{},
+		MaxRetries:    1000,
+		Store:         &memory.RecordStore{},
+	}
+	rev, err := s.CompareAndWrite("counter", 0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if rev != 1 {
+		t.Fatalf("unexpected revision: wanted 1, got %d", rev)
+	}
+	_, err = s.CompareAndWrite("counter", 5, 0)
+	conflict := &storage.ConflictError{}
+	if !errors.As(err, &conflict) || conflict.Actual != 1 || conflict.Expected != 0 {
+		t.Fatalf("expected a ConflictError, got %v", err)
+	}
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatal("expected the conflict to match ErrConflict")
+	}
+
+	writers := 20
+	errs := make(chan error)
+	for i := 0; i < writers; i++ {
+		go func() {
+			errs <- s.Update(func(tx *storage.Tx) error {
+				var count int
+				err := tx.Read("counter", &count)
+				if err != nil {
+					return err
+				}
+				return tx.Write("counter", count+1)
+			})
+		}()
+	}
+	for i := 0; i < writers; i++ {
+		err := <-errs
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	var count int
+	rev, err = s.ReadRevision("counter", &count)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if count != writers || rev != storage.Revision(writers+1) {
+		t.Fatalf("expected no lost updates: wanted count %d, got %d at revision %d", writers, count, rev)
+	}
+}
+
+func TestBinaryEncodings(t *testing.T) {
+	encoders := map[string]storage.RecordEncodeDecoder{
+		"cbor":     &cbor.EncodeDecoder{},
+		"json":     &json.EncodeDecoder{},
+		"protobuf": &protobuf.EncodeDecoder{},
+	}
+	for name, ed := range encoders {
+		t.Run(name, func(t *testing.T) {
+			s := &storage.Service{
+				EncodeDecoder: ed,
+				Store:         &memory.RecordStore{},
+			}
+			b1 := testBlock()
+			err := s.Write("block", b1)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			b2 := &block.Block{}
+			err = s.Read("block", b2)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if b2.Hash != b1.Hash || b2.Index != b1.Index || b2.Timestamp != b1.Timestamp || !bytes.Equal(b2.Data, b1.Data) {
+				t.Fatalf("decoded block does not match: wanted %v, got %v", b1, b2)
+			}
+		})
+	}
+}
+
+func BenchmarkEncodeDecoders(b *testing.B) {
+	encoders := map[string]storage.RecordEncodeDecoder{
+		"cbor":     &cbor.EncodeDecoder{},
+		"json":     &json.EncodeDecoder{},
+		"protobuf": &protobuf.EncodeDecoder{},
+	}
+	record := testBlock()
+	for name, ed := range encoders {
+		b.Run(name+"/encode", func(b *testing.B) {
+			var size int
+			for i := 0; i < b.N; i++ {
+				data, err := ed.EncodeRecord(record)
+				if err != nil {
+					b.Fatalf("%v", err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/record")
+		})
+		b.Run(name+"/decode", func(b *testing.B) {
+			data, err := ed.EncodeRecord(record)
+			if err != nil {
+				b.Fatalf("%v", err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := ed.DecodeRecord(data, &block.Block{})
+				if err != nil {
+					b.Fatalf("%v", err)
+				}
+			}
+		})
+	}
+}
+
+func testBlock() *block.Block {
+	c := &block.Chain{}
+	b := c.NewBlock(bytes.Repeat([]byte("data"), 64))
+	err := c.AddBlock(b)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestMigrations(t *testing.T) {
+	store := &memory.RecordStore{}
+	v1 := &storage.Service{
+		EncodeDecoder: &json.EncodeDecoder{},
+		Store:         store,
+	}
+	err := v1.Write("user-1", &testUserV1{
+		Name: "Ada Lovelace",
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	migrations := &storage.Migrations{}
+	v2 := &storage.Service{
+		Decoders: map[string]storage.RecordEncodeDecoder{
+			"json": &json.EncodeDecoder{},
+		},
+		EncodeDecoder: &cbor.EncodeDecoder{},
+		Migrations:    migrations,
+		Store:         store,
+	}
+	err = v2.Read("user-1", &testUserV2{})
+	if err != storage.ErrNoMigration {
+		t.Fatalf("expected ErrNoMigration, got %v", err)
+	}
+	err = migrations.Register("test.user", 1, func(data []byte, ed storage.RecordEncodeDecoder) ([]byte, error) {
+		old := &testUserV1{}
+		err := ed.DecodeRecord(data, old)
+		if err != nil {
+			return nil, err
+		}
+		names := strings.SplitN(old.Name, " ", 2)
+		return ed.EncodeRecord(&testUserV2{
+			First: names[0],
+			Last:  names[1],
+		})
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	user := &testUserV2{}
+	err = v2.Read("user-1", user)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if user.First != "Ada" || user.Last != "Lovelace" {
+		t.Fatalf("expected the record to be migrated on read, got %v", user)
+	}
+
+	migrated, err := v2.Migrate(nil, func() interface{} {
+		return &testUserV2{}
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if migrated != 1 {
+		t.Fatalf("expected 1 record to be migrated, got %d", migrated)
+	}
+	current := &storage.Service{
+		EncodeDecoder: &cbor.EncodeDecoder{},
+		Store:         store,
+	}
+	user = &testUserV2{}
+	err = current.Read("user-1", user)
+	if err != nil {
+		t.Fatalf("expected the record to be rewritten with the current encoding and schema: %v", err)
+	}
+	if user.First != "Ada" {
+		t.Fatalf("unexpected migrated record: %v", user)
+	}
+	migrated, err = v2.Migrate(nil, func() interface{} {
+		return &testUserV2{}
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if migrated != 0 {
+		t.Fatal("expected current records to be left alone")
+	}
+	err = current.Read("user-1", &testUserV1{})
+	if err != storage.ErrNewerSchema {
+		t.Fatalf("expected ErrNewerSchema reading a record into an older schema, got %v", err)
+	}
+
+	// Untyped records are only migrated when selected by prefix.
+	err = v1.Write("note-1", "untyped")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = v1.Write("post-1", &testPost{Author: "ada"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	migrated, err = v2.Migrate(nil, func() interface{} {
+		return &testUserV2{}
+	})
+	if err != nil || migrated != 0 {
+		t.Fatalf("expected untyped records to be skipped, got %d, %v", migrated, err)
+	}
+	migrated, err = v2.Migrate(&storage.ListOptions{Prefix: "post-"}, func() interface{} {
+		return &testPost{}
+	})
+	if err != nil || migrated != 1 {
+		t.Fatalf("expected untyped records selected by prefix to be migrated, got %d, %v", migrated, err)
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	store := &memory.RecordStore{}
+	indexes := []*storage.Index{
+		{
+			Keys: func(record interface{}) []string {
+				return []string{record.(*testPost).Author}
+			},
+			Name: "author",
+			NewRecord: func() interface{} {
+				return &testPost{}
+			},
+			Prefix: "post-",
+		},
+		{
+			Keys: func(record interface{}) []string {
+				return record.(*testPost).Tags
+			},
+			Name:   "tag",
+			Prefix: "post-",
+		},
+	}
+	s := &storage.Service{
+		EncodeDecoder: &json.EncodeDecoder{},
+		Indexes:       indexes,
+		Store:         store,
+	}
+	lookup := func(name string, key string) string {
+		ids, err := s.Lookup(name, key)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		joined := make([]string, len(ids))
+		for i, id := range ids {
+			joined[i] = string(id)
+		}
+		return strings.Join(joined, ",")
+	}
+
+	posts := map[storage.RecordID]*testPost{
+		"post-1": {Author: "carol", Tags: []string{"go", "db", "go"}},
+		"post-2": {Author: "bob", Tags: []string{"go"}},
+		"post-3": {Author: "alice"},
+	}
+	for id, post := range posts {
+		err := s.Write(id, post)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if got := lookup("tag", "go"); got != "post-1,post-2" {
+		t.Fatalf("expected posts tagged go, got %s", got)
+	}
+	_, err := s.CompareAndWrite("post-1", &testPost{Author: "alice", Tags: []string{"db"}}, 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if got := lookup("author", "alice"); got != "post-1,post-3" {
+		t.Fatalf("expected posts by alice, got %s", got)
+	}
+	if got := lookup("author", "carol"); got != "" {
+		t.Fatalf("expected the old author key to be removed, got %s", got)
+	}
+	if got := lookup("tag", "go"); got != "post-2" {
+		t.Fatalf("expected the old tag key to be removed, got %s", got)
+	}
+
+	err = s.Transaction(func(tx *storage.Tx) error {
+		tx.Delete("post-2")
+		return tx.Write("post-4", &testPost{Author: "bob"})
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if got := lookup("author", "bob"); got != "post-4" {
+		t.Fatalf("expected the transaction to update the index, got %s", got)
+	}
+	if got := lookup("tag", "go"); got != "" {
+		t.Fatalf("expected a deleted post's keys to be removed, got %s", got)
+	}
+
+	entries, err := s.LookupRange("author", "alice", "bob", 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != "post-1" || entries[1].ID != "post-3" || entries[0].Key != "alice" {
+		t.Fatal("expected the range to include alice and exclude bob")
+	}
+	entries, err = s.LookupRange("author", "b", "", 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != "post-4" {
+		t.Fatal("expected an unbounded range to start from its first key")
+	}
+
+	ids, err := s.List(&storage.ListOptions{Prefix: "post-"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("expected index entries to be kept apart from records, got %v", ids)
+	}
+	limited, err := s.List(&storage.ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(limited) != 2 || limited[0] != ids[0] || limited[1] != ids[1] {
+		t.Fatalf("expected listings to skip index entries, got %v", limited)
+	}
+	records, err := s.ListRecords(nil, func() interface{} {
+		return &testPost{}
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected only records to be decoded, got %d", len(records))
+	}
+	migrated, err := s.Migrate(nil, func() interface{} {
+		return &testPost{}
+	})
+	if err != nil || migrated != 0 {
+		t.Fatalf("expected migrations to skip index entries, got %d, %v", migrated, err)
+	}
+
+	// Records changed by a service without the index leave its entries stale until it is rebuilt.
+	unindexed := &storage.Service{
+		EncodeDecoder: &json.EncodeDecoder{},
+		Store:         store,
+	}
+	err = unindexed.Delete("post-3")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = unindexed.Write("post-5", &testPost{Author: "alice"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = s.RebuildIndex("author")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if got := lookup("author", "alice"); got != "post-1,post-5" {
+		t.Fatalf("expected the rebuilt index to match the records, got %s", got)
+	}
+
+	err = s.RebuildIndex("tag")
+	if err != storage.ErrInvalidIndex {
+		t.Fatalf("expected ErrInvalidIndex without NewRecord, got %v", err)
+	}
+	_, err = s.Lookup("missing", "")
+	if err != storage.ErrUnknownIndex {
+		t.Fatalf("expected ErrUnknownIndex, got %v", err)
+	}
+}
+
+func TestRecordCache(t *testing.T) {
+	store := &cache.RecordStore{
+		Cache: &common.LRU{MaxSize: 64},
+		Store: &memory.RecordStore{},
+	}
+	s := &storage.Service{
+		EncodeDecoder: &json.EncodeDecoder{},
+		Store:         store,
+	}
+	err := s.Write("post-1", &testPost{Author: "alice"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	post := &testPost{}
+	err = s.Read("post-1", post)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if stats := store.Stats(); stats.Hits != 1 {
+		t.Fatalf("expected written records to be read from the cache, got %+v", stats)
+	}
+
+	// Writing a record larger than the cache evicts every other record.
+	err = s.Write("post-2", &testPost{Author: strings.Repeat("b", 64)})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	misses := store.Stats().Misses
+	err = s.Read("post-1", post)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if stats := store.Stats(); stats.Misses != misses+1 || stats.Evictions != 2 || post.Author != "alice" {
+		t.Fatalf("expected evicted records to be read from the store, got %+v", stats)
+	}
+	err = s.Delete("post-1")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = s.Read("post-1", post)
+	if err != storage.ErrRecordNotFound {
+		t.Fatalf("expected deleted records to be dropped from the cache, got %v", err)
+	}
+
+	decoded := &common.LRU{MaxEntries: 1}
+	s.Cache = decoded
+	err = s.Write("post-3", &testPost{Author: "carol", Tags: []string{"go"}})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i := 0; i < 2; i++ {
+		post := &testPost{}
+		err = s.Read("post-3", post)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if post.Author != "carol" || len(post.Tags) != 1 {
+			t.Fatalf("expected the cached record to be decoded, got %+v", post)
+		}
+		post.Tags[0] = "modified"
+	}
+	if stats := decoded.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("expected the second read to be decoded from the cache, got %+v", stats)
+	}
+	err = s.Write("post-3", &testPost{Author: "dave"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = s.Read("post-3", post)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if post.Author != "dave" {
+		t.Fatal("expected writes to invalidate decoded records")
+	}
+}
+
+func TestChainRecordStore(t *testing.T) {
+	manager := &block.Manager{
+		Service: &block.Service{
+			BlockStore: &blockmemory.BlockStore{},
+			ChainStore: &blockmemory.ChainStore{},
+		},
+	}
+	c, err := manager.NewChain()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	store := &chain.RecordStore{
+		Chain:   c.Hash,
+		Manager: manager,
+	}
+	err = store.Write("a", []byte("1"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = store.Write("a", []byte("2"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	batch := &storage.Batch{}
+	batch.Delete("a")
+	batch.Write("b", []byte("1"))
+	err = store.CommitBatch(batch)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = store.Delete("missing")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(c.Hashes()) != 4 {
+		t.Fatalf("expected a block for each change, got %d blocks", len(c.Hashes()))
+	}
+
+	for i, want := range []string{"", "1", "2", ""} {
+		data, err := store.ReadAt("a", block.Index(i))
+		if want == "" && err != storage.ErrRecordNotFound || want != "" && string(data) != want {
+			t.Fatalf("unexpected data for record a at block %d: %q, %v", i, data, err)
+		}
+	}
+	history, err := store.History("a")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(history) != 3 || !history[2].Deleted || history[2].Block != c.LastHash {
+		t.Fatal("expected the history to hold every change to the record")
+	}
+	if string(history[0].Data) != "1" || string(history[1].Data) != "2" || history[2].Data != nil {
+		t.Fatal("expected the history to read each version's data from its block")
+	}
+
+	// A new store replays the chain into its view.
+	view := &memory.RecordStore{}
+	err = view.Write("stale", []byte("x"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	replayed := &chain.RecordStore{
+		Chain:   c.Hash,
+		Manager: manager,
+		View:    view,
+	}
+	s := &storage.Service{
+		EncodeDecoder: &json.EncodeDecoder{},
+		Store:         replayed,
+	}
+	ids, err := s.List(nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(ids) != 1 || ids[0] != "b" {
+		t.Fatalf("expected the view to match the chain, got %v", ids)
+	}
+	err = s.Transaction(func(tx *storage.Tx) error {
+		err := tx.Write("c", "3")
+		if err != nil {
+			return err
+		}
+		return tx.Write("d", "4")
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var value string
+	err = s.Read("d", &value)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if value != "4" || len(c.Hashes()) != 5 {
+		t.Fatal("expected a transaction to be committed as a single block")
+	}
+
+	payload, err := manager.Service.ReadBlock(c.LastHash)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	registry := &block.PayloadRegistry{}
+	err = chain.RegisterPayload(registry)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	decoded, err := registry.Decode(payload.Data)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if b := decoded.(*storage.Batch); len(b.Ops) != 2 || b.Ops[1].ID != "d" {
+		t.Fatal("expected blocks to hold the committed batch")
+	}
+
+	// A view that cannot be updated does not undo the appended block.
+	failing := &failingRecordStore{}
+	unapplied := &chain.RecordStore{
+		Chain:   c.Hash,
+		Manager: manager,
+		View:    failing,
+	}
+	_, err = unapplied.List(nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	failing.fail = true
+	err = unapplied.Write("e", []byte("5"))
+	if !errors.Is(err, storage.ErrNotApplied) {
+		t.Fatalf("expected a committed write the view could not apply to return ErrNotApplied, got %v", err)
+	}
+	failing.fail = false
+	data, err := unapplied.Read("e")
+	if err != nil || string(data) != "5" || len(c.Hashes()) != 6 {
+		t.Fatal("expected the view to be rebuilt with the committed write")
+	}
+
+	c.PrunedIndex = 1
+	pruned := &chain.RecordStore{
+		Chain:   c.Hash,
+		Manager: manager,
+	}
+	_, err = pruned.List(nil)
+	if err != chain.ErrChainPruned {
+		t.Fatalf("expected ErrChainPruned for a pruned chain, got %v", err)
+	}
+}
+
+// failingRecordStore fails every write while fail is set.
+type failingRecordStore struct {
+	memory.RecordStore
+	fail bool
+}
+
+func (s *failingRecordStore) CommitBatch(b *storage.Batch) error {
+	if s.fail {
+		return errors.New("batch failed")
+	}
+	return s.RecordStore.CommitBatch(b)
+}
+
+func (s *failingRecordStore) Write(id storage.RecordID, data []byte) error {
+	if s.fail {
+		return errors.New("write failed")
+	}
+	return s.RecordStore.Write(id, data)
+}
+
+func TestEncryptedRecords(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	rootDir := dir + "/testdata/encrypted"
+	defer os.RemoveAll(rootDir)
+	kr := &encryption.FileKeyring{
+		Dir: rootDir + "/keyring",
+	}
+	files := &file.RecordStore{
+		RootDir: rootDir + "/records",
+	}
+
+	// Records written before encryption was enabled stay readable until they are resealed.
+	err = files.Write("legacy", []byte(`"plain"`))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	store := &encrypted.RecordStore{
+		AllowPlaintext: true,
+		Keyring:        kr,
+		Store:          files,
+	}
+	s := &storage.Service{
+		EncodeDecoder: &json.EncodeDecoder{},
+		Store:         store,
+	}
+	err = s.Write("post-1", &testPost{Author: "alice"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	data, err := ioutil.ReadFile(files.RootDir + "/post-1")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if bytes.Contains(data, []byte("alice")) || !encryption.IsSealed(data) {
+		t.Fatal("expected records to be encrypted at rest")
+	}
+	var legacy string
+	err = s.Read("legacy", &legacy)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if legacy != "plain" {
+		t.Fatalf("unexpected plaintext record: %s", legacy)
+	}
+
+	err = os.Rename(files.RootDir+"/post-1", files.RootDir+"/post-2")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = s.Read("post-2", &testPost{})
+	if err == nil {
+		t.Fatal("expected a record moved to another ID to fail to open")
+	}
+	err = s.Delete("post-2")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = s.Write("post-1", &testPost{Author: "alice"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	rot, err := encryption.Rotate(kr, []encryption.Reencrypter{store})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	n, err := rot.Wait()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected both records to be resealed, got %d", n)
+	}
+	for _, id := range []string{"legacy", "post-1"} {
+		data, err := files.Read(storage.RecordID(id))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		keyID, err := encryption.SealedKeyID(data)
+		if err != nil || keyID != rot.KeyID {
+			t.Fatalf("expected record %s to be sealed with the new key", id)
+		}
+	}
+	post := &testPost{}
+	err = s.Read("post-1", post)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if post.Author != "alice" {
+		t.Fatal("expected resealed records to be readable")
+	}
+}
+
+type testPost struct {
+	Author string
+	Tags   []string
+}
+
+func (p *testPost) CopyRecord() interface{} {
+	c := *p
+	c.Tags = append([]string(nil), p.Tags...)
+	return &c
+}
+
+type testUserV1 struct {
+	Name string
+}
+
+func (u *testUserV1) RecordType() string {
+	return "test.user"
+}
+
+func (u *testUserV1) SchemaVersion() uint64 {
+	return 1
+}
+
+type testUserV2 struct {
+	First string
+	Last  string
+}
+
+func (u *testUserV2) RecordType() string {
+	return "test.user"
+}
+
+func (u *testUserV2) SchemaVersion() uint64 {
+	return 2
+}
+
 var _ storage.RecordEncodeDecoder = &testEncodeDecoder{}
 
 type testEncodeDecoder struct{}
@@ -113,9 +1175,17 @@ func (s *testRecordStore) Delete(id storage.RecordID) error {
 	return nil
 }
 
+func (s *testRecordStore) List(opts *storage.ListOptions) ([]storage.RecordID, error) {
+	ids := make([]storage.RecordID, 0, len(s.records))
+	for id := range s.records {
+		ids = append(ids, id)
+	}
+	return opts.Apply(ids), nil
+}
+
 func (s *testRecordStore) Read(id storage.RecordID) ([]byte, error) {
 	if s.records == nil || s.records[id] == nil {
-		return nil, errors.New("unknown record ID")
+		return nil, storage.ErrRecordNotFound
 	}
 	return s.records[id], nil
 }